@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// amountKey — ключ таблицы остатков: сколько наличия у поставщика и сколько штук в упаковке.
+type amountKey struct {
+	AvailableCount int
+	Pcs            int
+}
+
+// defaultAmountTable — встроенная таблица calcAmount. Всё, чего здесь нет, даёт 0.
+var defaultAmountTable = map[amountKey]int{
+	{AvailableCount: 5, Pcs: 100}: 1,
+	{AvailableCount: 5, Pcs: 50}:  1,
+	{AvailableCount: 5, Pcs: 30}:  2,
+	{AvailableCount: 5, Pcs: 10}:  5,
+	{AvailableCount: 4, Pcs: 30}:  1,
+	{AvailableCount: 4, Pcs: 10}:  3,
+	{AvailableCount: 5, Pcs: 1}:   5,
+	{AvailableCount: 5, Pcs: 3}:   3,
+	{AvailableCount: 5, Pcs: 5}:   2,
+}
+
+// amountTable — действующая таблица; заменяется loadAmountTable при старте.
+var amountTable = defaultAmountTable
+
+type amountRow struct {
+	AvailableCount int `json:"available_count"`
+	Pcs            int `json:"pcs"`
+	Amount         int `json:"amount"`
+}
+
+// loadAmountTable читает таблицу остатков из .json (массив объектов
+// available_count/pcs/amount) или .csv с заголовком available_count,pcs,amount.
+// Один и тот же ключ с разными amount считается ошибкой.
+func loadAmountTable(path string) (map[amountKey]int, error) {
+	var rows []amountRow
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		rows, err = readAmountJSON(path)
+	} else {
+		rows, err = readAmountCSV(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(map[amountKey]int, len(rows))
+	for _, r := range rows {
+		key := amountKey{AvailableCount: r.AvailableCount, Pcs: r.Pcs}
+		if prev, ok := table[key]; ok && prev != r.Amount {
+			return nil, fmt.Errorf("%s: для available_count=%d, pcs=%d заданы разные amount: %d и %d",
+				path, r.AvailableCount, r.Pcs, prev, r.Amount)
+		}
+		table[key] = r.Amount
+	}
+	log.Printf("Загружено %d правил остатков из %s", len(table), path)
+	return table, nil
+}
+
+func readAmountJSON(path string) ([]amountRow, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при открытии файла %s: %v", path, err)
+	}
+	var rows []amountRow
+	if err := json.Unmarshal(b, &rows); err != nil {
+		return nil, fmt.Errorf("ошибка разбора %s: %v", path, err)
+	}
+	return rows, nil
+}
+
+func readAmountCSV(path string) ([]amountRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при открытии файла %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var rows []amountRow
+	scanner := bufio.NewScanner(f)
+	isHeader := true
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if isHeader {
+			isHeader = false // Пропускаем заголовок
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Split(line, ",")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%s:%d: ожидается 3 колонки, получено %d", path, lineNum, len(parts))
+		}
+		var vals [3]int
+		for i, p := range parts {
+			v, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineNum, err)
+			}
+			vals[i] = v
+		}
+		rows = append(rows, amountRow{AvailableCount: vals[0], Pcs: vals[1], Amount: vals[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при чтении %s: %v", path, err)
+	}
+	return rows, nil
+}
+
+// booleanAvailability — поставщик сообщает только "есть/нет", без количества:
+// у него нет селектора Availability, availableCount — условный InStockValue.
+func booleanAvailability(cfg Config, vendorCode string) bool {
+	return cfg.Selectors[supplierForVendorCode(vendorCode)].Availability == ""
+}
+
+// stockAmount — остаток для WB. Для поставщиков "есть/нет" при заданном
+// DefaultInStockAmount(ByPcs) остаток берётся оттуда, а не из amountTable:
+// так таблица остаётся про количество магазинов cargo-avto и не зависит от
+// условного InStockValue. Иначе — calcAmount, как раньше. Полученный остаток
+// умножается на AvailabilityMultiplier(ByPattern): amountTable ищет точное
+// наличие, поэтому умножать наличие до поиска нельзя.
+func stockAmount(cfg Config, vendorCode string, pcs, availableCount int) int {
+	return scaleAmount(cfg, vendorCode, baseStockAmount(cfg, vendorCode, pcs, availableCount))
+}
+
+func baseStockAmount(cfg Config, vendorCode string, pcs, availableCount int) int {
+	if cfg.DefaultInStockAmount <= 0 && len(cfg.DefaultInStockAmountByPcs) == 0 {
+		return calcAmount(pcs, availableCount)
+	}
+	if !booleanAvailability(cfg, vendorCode) {
+		return calcAmount(pcs, availableCount)
+	}
+	if availableCount <= 0 {
+		return 0
+	}
+	if amount, ok := cfg.DefaultInStockAmountByPcs[pcs]; ok {
+		return amount
+	}
+	return cfg.DefaultInStockAmount
+}
+
+// validateAvailabilityMultipliers проверяет множители и шаблоны.
+func validateAvailabilityMultipliers(cfg Config) error {
+	for supplier, m := range cfg.AvailabilityMultiplier {
+		if m <= 0 {
+			return fmt.Errorf("AvailabilityMultiplier[%q] = %v: множитель должен быть больше 0", supplier, m)
+		}
+	}
+	for pattern, m := range cfg.AvailabilityMultiplierByPattern {
+		if m <= 0 {
+			return fmt.Errorf("AvailabilityMultiplierByPattern[%q] = %v: множитель должен быть больше 0", pattern, m)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("AvailabilityMultiplierByPattern: некорректный шаблон %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// availabilityMultiplier — множитель остатка для артикула. Из нескольких
+// подходящих шаблонов берётся первый по алфавиту, чтобы результат не зависел
+// от порядка обхода map. Шаблоны компилируются на каждый вызов, как в
+// matchedPattern: их единицы, а общий кэш пережил бы смену конфига в -serve.
+func availabilityMultiplier(cfg Config, vendorCode string) float64 {
+	if len(cfg.AvailabilityMultiplierByPattern) > 0 {
+		patterns := make([]string, 0, len(cfg.AvailabilityMultiplierByPattern))
+		for p := range cfg.AvailabilityMultiplierByPattern {
+			patterns = append(patterns, p)
+		}
+		sort.Strings(patterns)
+		for _, p := range patterns {
+			if re, err := regexp.Compile(p); err == nil && re.MatchString(vendorCode) {
+				return cfg.AvailabilityMultiplierByPattern[p]
+			}
+		}
+	}
+	if m, ok := cfg.AvailabilityMultiplier[supplierForVendorCode(vendorCode)]; ok {
+		return m
+	}
+	return 1
+}
+
+// scaleAmount применяет AvailabilityMultiplier(ByPattern) к остатку для WB.
+func scaleAmount(cfg Config, vendorCode string, amount int) int {
+	m := availabilityMultiplier(cfg, vendorCode)
+	if m == 1 || amount <= 0 {
+		return amount
+	}
+	return int(math.Round(float64(amount) * m))
+}
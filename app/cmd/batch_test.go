@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// stockServer — мок PUT /api/v3/stocks/{warehouseId}: запоминает размер каждой пачки.
+type stockServer struct {
+	mu      sync.Mutex
+	batches []int
+	skus    map[string]int
+}
+
+func newStockServer(t *testing.T) (*stockServer, *httptest.Server) {
+	s := &stockServer{skus: make(map[string]int)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != fmt.Sprintf("/api/v3/stocks/%d", WarehouseID) {
+			http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		var req stockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.batches = append(s.batches, len(req.Stocks))
+		for _, item := range req.Stocks {
+			s.skus[item.SKU] = item.Amount
+		}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func TestUpdateStocksBatches(t *testing.T) {
+	tests := []struct {
+		items int
+		want  []int
+	}{
+		{0, nil},
+		{1, []int{1}},
+		{999, []int{999}},
+		{1000, []int{1000}},
+		{1001, []int{1000, 1}},
+		{2500, []int{1000, 1000, 500}},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.items), func(t *testing.T) {
+			db, path := newTestDB(t)
+			products := make([]testProduct, tt.items)
+			for i := range products {
+				products[i] = testProduct{
+					VendorCode:     fmt.Sprintf("box_%d_10", i),
+					ProductID:      strconv.Itoa(i),
+					SKU:            strconv.Itoa(2000000000000 + i),
+					Pcs:            10,
+					AvailableCount: 5,
+				}
+			}
+			insertProducts(t, db, products...)
+
+			stocks, srv := newStockServer(t)
+			cfg := testConfig(t, path)
+			cfg.WBStocksURL = srv.URL + "/api/v3/stocks/%d"
+
+			result, err := updateStocks(context.Background(), "test-key", cfg)
+			if err != nil {
+				t.Fatalf("updateStocks: %v", err)
+			}
+
+			if fmt.Sprint(stocks.batches) != fmt.Sprint(tt.want) {
+				t.Errorf("пачки %v, want %v", stocks.batches, tt.want)
+			}
+			if len(stocks.skus) != tt.items {
+				t.Errorf("в WB пришло %d SKU, want %d", len(stocks.skus), tt.items)
+			}
+			if result.BatchesSent != len(tt.want) || result.SKUsUpdated != tt.items || result.FailedBatches != 0 {
+				t.Errorf("результат %+v, want пачек %d, SKU %d", result, len(tt.want), tt.items)
+			}
+		})
+	}
+}
+
+// TestUpdateStocksEmptySKU: строки с пустым SKU не попадают в пачку — WB
+// отклонил бы из-за них всю пачку, — а пачка из одних пустых не отправляется.
+func TestUpdateStocksEmptySKU(t *testing.T) {
+	tests := []struct {
+		name      string
+		skus      []string
+		wantSent  []string
+		wantPuts  int
+		wantEmpty int
+	}{
+		{"вперемешку", []string{"2000000000011", "", "  ", "2000000000028", " , "}, []string{"2000000000011", "2000000000028"}, 1, 3},
+		{"только пустые", []string{"", " ", ","}, nil, 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skipped.reset()
+			db, path := newTestDB(t)
+			for i, sku := range tt.skus {
+				insertProducts(t, db, testProduct{
+					VendorCode:     fmt.Sprintf("box_%d_10", i),
+					ProductID:      strconv.Itoa(i),
+					SKU:            sku,
+					Pcs:            10,
+					AvailableCount: 5,
+				})
+			}
+			stocks, srv := newStockServer(t)
+			cfg := testConfig(t, path)
+			cfg.WBStocksURL = srv.URL + "/api/v3/stocks/%d"
+
+			result, err := updateStocks(context.Background(), "test-key", cfg)
+			if err != nil {
+				t.Fatalf("updateStocks: %v", err)
+			}
+			if len(stocks.batches) != tt.wantPuts {
+				t.Errorf("PUT %d раз, want %d", len(stocks.batches), tt.wantPuts)
+			}
+			if len(stocks.skus) != len(tt.wantSent) {
+				t.Errorf("в WB пришли %v, want %v", stocks.skus, tt.wantSent)
+			}
+			for _, sku := range tt.wantSent {
+				if _, ok := stocks.skus[sku]; !ok {
+					t.Errorf("SKU %s не отправлен", sku)
+				}
+			}
+			if _, ok := stocks.skus[""]; ok {
+				t.Error("в WB ушёл пустой SKU")
+			}
+			if result.SKUsSkipped != tt.wantEmpty {
+				t.Errorf("SKUsSkipped = %d, want %d", result.SKUsSkipped, tt.wantEmpty)
+			}
+			if got := skippedByReason(skipped, &deadLetterLog{})[reasonEmptySKU]; got != tt.wantEmpty {
+				t.Errorf("пропущено с %s: %d, want %d", reasonEmptySKU, got, tt.wantEmpty)
+			}
+		})
+	}
+}
+
+// TestUpdateStocksDryRun: в DryRun в WB ничего не уходит, и пачки не
+// считаются обновлёнными.
+func TestUpdateStocksDryRun(t *testing.T) {
+	db, path := newTestDB(t)
+	insertProducts(t, db,
+		testProduct{VendorCode: "box_1_10", ProductID: "1", SKU: "2000000000011", Pcs: 10, AvailableCount: 5},
+		testProduct{VendorCode: "box_2_10", ProductID: "2", SKU: "2000000000028", Pcs: 10, AvailableCount: 4},
+	)
+	if _, err := db.Exec(`UPDATE products SET active = 0 WHERE product_id = '2'`); err != nil {
+		t.Fatal(err)
+	}
+	stocks, srv := newStockServer(t)
+	cfg := testConfig(t, path)
+	cfg.WBStocksURL = srv.URL + "/api/v3/stocks/%d"
+	cfg.DryRun = true
+
+	result, err := updateStocks(context.Background(), "test-key", cfg)
+	if err != nil {
+		t.Fatalf("updateStocks: %v", err)
+	}
+	if len(stocks.batches) != 0 {
+		t.Errorf("в DryRun ушло %d PUT", len(stocks.batches))
+	}
+	want := PushResult{SKUsDryRun: 1}
+	if result != want {
+		t.Errorf("результат %+v, want %+v", result, want)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestCalcAmount(t *testing.T) {
+	prev := amountTable
+	amountTable = defaultAmountTable
+	t.Cleanup(func() { amountTable = prev })
+
+	tests := []struct {
+		name                string
+		pcs, availableCount int
+		want                int
+	}{
+		// Все строки defaultAmountTable
+		{"5 магазинов, 100 шт", 100, 5, 1},
+		{"5 магазинов, 50 шт", 50, 5, 1},
+		{"5 магазинов, 30 шт", 30, 5, 2},
+		{"5 магазинов, 10 шт", 10, 5, 5},
+		{"4 магазина, 30 шт", 30, 4, 1},
+		{"4 магазина, 10 шт", 10, 4, 3},
+		{"5 магазинов, 1 шт", 1, 5, 5},
+		{"5 магазинов, 3 шт", 3, 5, 3},
+		{"5 магазинов, 5 шт", 5, 5, 2},
+
+		// Нет в таблице — 0
+		{"4 магазина, 100 шт", 100, 4, 0},
+		{"4 магазина, 1 шт", 1, 4, 0},
+		{"3 магазина, 10 шт", 10, 3, 0},
+		{"6 магазинов, 10 шт", 10, 6, 0},
+		{"нет в наличии", 10, 0, 0},
+		{"неизвестная упаковка", 500, 5, 0},
+		{"нулевая упаковка", 0, 5, 0},
+
+		// Отрицательные значения
+		{"отрицательное наличие", 10, -5, 0},
+		{"отрицательная упаковка", -10, 5, 0},
+		{"всё отрицательное", -1, -1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calcAmount(tt.pcs, tt.availableCount); got != tt.want {
+				t.Errorf("calcAmount(%d, %d) = %d, want %d", tt.pcs, tt.availableCount, got, tt.want)
+			}
+		})
+	}
+
+	// Каждая строка таблицы должна быть покрыта выше
+	for key, amount := range defaultAmountTable {
+		found := false
+		for _, tt := range tests {
+			if tt.pcs == key.Pcs && tt.availableCount == key.AvailableCount && tt.want == amount {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("строка таблицы %+v -> %d не покрыта тестом", key, amount)
+		}
+	}
+}
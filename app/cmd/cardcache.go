@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// loadCachedCards читает карточки из кеша, если файл моложе ttl.
+// Второе значение false означает, что кеша нет или он устарел.
+func loadCachedCards(path string, ttl time.Duration) ([]Card, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	if age := time.Since(info.ModTime()); age > ttl {
+		log.Printf("Кеш карточек %s устарел (%s), загружаем заново", path, age.Round(time.Second))
+		return nil, false
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Ошибка чтения кеша карточек %s: %v", path, err)
+		return nil, false
+	}
+	var cards []Card
+	if err := json.Unmarshal(b, &cards); err != nil {
+		log.Printf("Ошибка разбора кеша карточек %s: %v", path, err)
+		return nil, false
+	}
+	return cards, true
+}
+
+func saveCachedCards(path string, cards []Card) error {
+	b, err := json.Marshal(cards)
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга карточек: %v", err)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return fmt.Errorf("ошибка записи кеша карточек %s: %v", path, err)
+	}
+	return nil
+}
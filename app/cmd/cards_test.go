@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestLastCardsPage(t *testing.T) {
+	const limit = 100
+	page := func(cards, total, nmID int, updatedAt string) *CardsListResponse {
+		r := &CardsListResponse{Cards: make([]Card, cards)}
+		r.Cursor.Total, r.Cursor.NmID, r.Cursor.UpdatedAt = total, nmID, updatedAt
+		return r
+	}
+	tests := []struct {
+		name string
+		resp *CardsListResponse
+		want bool
+	}{
+		{"неполная страница с курсором", page(99, 99, 42, "2026-01-01T00:00:00Z"), true},
+		{"ровно limit с курсором", page(100, 100, 42, "2026-01-01T00:00:00Z"), false},
+		{"ровно limit без курсора", page(100, 100, 0, ""), true},
+		{"ровно limit без nmID", page(100, 100, 0, "2026-01-01T00:00:00Z"), true},
+		{"total не задан, карточек limit", page(100, 0, 42, "2026-01-01T00:00:00Z"), false},
+		{"total не задан, карточек меньше", page(1, 0, 42, "2026-01-01T00:00:00Z"), true},
+		{"пустая страница", page(0, 0, 0, ""), true},
+		{"total меньше числа карточек", page(100, 50, 42, "2026-01-01T00:00:00Z"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lastCardsPage(tt.resp, limit); got != tt.want {
+				t.Errorf("lastCardsPage = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// cardsServer — мок cards/list: отдаёт total карточек страницами по limit,
+// продолжая с cursor.nmID, как WB.
+func cardsServer(t *testing.T, total int, requests *int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		var body struct {
+			Settings struct {
+				Cursor struct {
+					Limit int `json:"limit"`
+					NmID  int `json:"nmID"`
+				} `json:"cursor"`
+			} `json:"settings"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var resp CardsListResponse
+		for id := body.Settings.Cursor.NmID + 1; id <= total && len(resp.Cards) < body.Settings.Cursor.Limit; id++ {
+			resp.Cards = append(resp.Cards, Card{NmID: id, VendorCode: "box_1_10"})
+		}
+		resp.Cursor.Total = len(resp.Cards)
+		if n := len(resp.Cards); n > 0 {
+			resp.Cursor.NmID = resp.Cards[n-1].NmID
+			resp.Cursor.UpdatedAt = "2026-01-01T00:00:00Z"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchAllCardsPageBoundary(t *testing.T) {
+	const limit = 10
+	tests := []struct {
+		name         string
+		total        int
+		wantRequests int
+	}{
+		{"карточек нет", 0, 1},
+		{"меньше страницы", 5, 1},
+		{"ровно страница", 10, 2},
+		{"ровно две страницы", 20, 3},
+		{"две с половиной страницы", 25, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			srv := cardsServer(t, tt.total, &requests)
+			cfg := testConfig(t, filepath.Join(t.TempDir(), "test.db"))
+			cfg.WBCardsListURL = srv.URL
+			cfg.CardsPageSize = limit
+			cfg.RateLimits[wbEndpointContent] = 600000
+			client := newWBClient("test-key", cfg)
+			defer client.Close()
+
+			cards, err := fetchAllCards(context.Background(), client, nil)
+			if err != nil {
+				t.Fatalf("fetchAllCards: %v", err)
+			}
+			if len(cards) != tt.total {
+				t.Errorf("карточек %d, want %d", len(cards), tt.total)
+			}
+			for i, c := range cards {
+				if c.NmID != i+1 {
+					t.Errorf("карточка %d: nmID %d, want %d", i, c.NmID, i+1)
+					break
+				}
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("запросов %d, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
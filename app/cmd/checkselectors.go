@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chromedp/chromedp"
+)
+
+// selectorProbe — результат проверки одного селектора на странице.
+type selectorProbe struct {
+	Count int    `json:"count"`
+	Text  string `json:"text"`
+}
+
+// probeSelector считает элементы по селектору и возвращает текст первого из них.
+func probeSelector(sel string, res *selectorProbe) chromedp.Action {
+	js := fmt.Sprintf(`(() => {
+		const els = document.querySelectorAll(%q);
+		return {count: els.length, text: els.length ? els[0].innerText.trim() : ""};
+	})()`, sel)
+	return chromedp.Evaluate(js, res)
+}
+
+// supplierForURL определяет поставщика по адресу страницы.
+func supplierForURL(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err == nil && strings.Contains(u.Host, "cargo-avto") {
+		return supplierCargoAvto
+	}
+	return supplierBubblebags
+}
+
+// runCheckSelectors открывает страницу поставщика и показывает, какие из
+// настроенных селекторов нашлись и что в них написано.
+func runCheckSelectors(cfg Config, args []string) error {
+	fs := flag.NewFlagSet("check-selectors", flag.ExitOnError)
+	pageURL := fs.String("url", "", "адрес страницы товара поставщика")
+	supplier := fs.String("supplier", "", "поставщик (bubblebags, cargo-avto); по умолчанию — по адресу")
+	fs.Parse(args)
+
+	if *pageURL == "" {
+		return fmt.Errorf("не задан -url")
+	}
+	if *supplier == "" {
+		*supplier = supplierForURL(*pageURL)
+	}
+	sel, ok := cfg.Selectors[*supplier]
+	if !ok {
+		return fmt.Errorf("неизвестный поставщик: %s", *supplier)
+	}
+
+	ctx, cancel, err := startChrome(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	ctx, timeoutCancel := context.WithTimeout(ctx, cfg.ScrapeTimeout)
+	defer timeoutCancel()
+	if _, ok := cfg.SupplierLogins[*supplier]; ok {
+		if err := loginSupplier(ctx, cfg, *supplier); err != nil {
+			return err
+		}
+	}
+
+	if err := navigate(ctx, *pageURL); err != nil {
+		return err
+	}
+	// Ждём первый из настроенных элементов; не дождались — всё равно показываем,
+	// что нашлось: для того эта команда и нужна
+	first := sel.Tab
+	if first == "" {
+		first = sel.Price
+	}
+	if err := chromedp.Run(ctx, waitReady(first, cfg.ReadyTimeout)); err != nil {
+		if !errors.Is(err, ErrSelectorMissing) {
+			return classifyScrapeError(*pageURL, err)
+		}
+		fmt.Fprintf(os.Stderr, "Внимание: %v\n", err)
+	}
+
+	checks := []struct {
+		name     string
+		selector string
+	}{
+		{"tab", sel.Tab},
+		{"price", sel.Price},
+		{"stock", sel.Stock},
+		{"availability", sel.Availability},
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Поставщик: %s\n", *supplier)
+	fmt.Fprintln(tw, "Селектор\tCSS\tНайдено\tТекст")
+	for _, c := range checks {
+		if c.selector == "" {
+			fmt.Fprintf(tw, "%s\t-\tне настроен\t\n", c.name)
+			continue
+		}
+		var res selectorProbe
+		if err := chromedp.Run(ctx, probeSelector(c.selector, &res)); err != nil {
+			fmt.Fprintf(tw, "%s\t%s\tошибка: %v\t\n", c.name, c.selector, err)
+			continue
+		}
+		status := "нет"
+		if res.Count > 0 {
+			status = fmt.Sprintf("да (%d)", res.Count)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%q\n", c.name, c.selector, status, res.Text)
+
+		// После вкладки кликаем по ней, чтобы остальные селекторы видели её содержимое
+		if c.name == "tab" && res.Count > 0 {
+			if err := chromedp.Run(ctx,
+				chromedp.Click(c.selector, chromedp.ByQuery),
+				waitReady(sel.Price, cfg.ReadyTimeout),
+			); err != nil {
+				fmt.Fprintf(tw, "%s\t%s\tклик не удался: %v\t\n", c.name, c.selector, err)
+			}
+		}
+	}
+	return tw.Flush()
+}
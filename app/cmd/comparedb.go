@@ -0,0 +1,158 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// productState — то, что сравнивается между двумя БД по одному товару.
+type productState struct {
+	VendorCode     string
+	Cost           int
+	AvailableCount int
+	Amount         int // остаток для WB по stockAmount, как его отправит updateStocks
+}
+
+// productDiff — товар, у которого что-то поменялось. Пустой Old или New
+// означает, что товара не было в старой или нет в новой БД.
+type productDiff struct {
+	Key string // productID/pcs
+	Old *productState
+	New *productState
+}
+
+// runCompareDB сравнивает две БД прогонов: compare-db [-csv] old.db new.db.
+// Остатки для WB обеих БД считаются по текущему конфигу.
+func runCompareDB(cfg Config, args []string) error {
+	fs := flag.NewFlagSet("compare-db", flag.ExitOnError)
+	asCSV := fs.Bool("csv", false, "вывести CSV вместо таблицы")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("использование: compare-db [-csv] old.db new.db")
+	}
+	if err := validateAvailabilityMultipliers(cfg); err != nil {
+		return err
+	}
+
+	oldProducts, err := readProductStates(cfg, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newProducts, err := readProductStates(cfg, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	diffs := diffProducts(oldProducts, newProducts)
+	if *asCSV {
+		return writeDiffCSV(os.Stdout, diffs)
+	}
+	writeDiffTable(os.Stdout, diffs)
+	return nil
+}
+
+// readProductStates читает products из файла БД, не создавая его.
+func readProductStates(cfg Config, path string) (map[string]productState, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("нет файла БД %s: %v", path, err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при открытии %s: %v", path, err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT product_id, pcs, vendor_code, cost, available_count FROM products`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения products из %s: %v", path, err)
+	}
+	defer rows.Close()
+
+	states := make(map[string]productState)
+	for rows.Next() {
+		var (
+			productID string
+			pcs       int
+			st        productState
+		)
+		if err := rows.Scan(&productID, &pcs, &st.VendorCode, &st.Cost, &st.AvailableCount); err != nil {
+			return nil, fmt.Errorf("ошибка чтения строки из %s: %v", path, err)
+		}
+		st.Amount = stockAmount(cfg, st.VendorCode, pcs, st.AvailableCount)
+		states[lastKnownKey(productID, pcs)] = st
+	}
+	return states, rows.Err()
+}
+
+// diffProducts возвращает изменившиеся, новые и пропавшие товары, отсортированные по ключу.
+func diffProducts(oldProducts, newProducts map[string]productState) []productDiff {
+	var diffs []productDiff
+	for key, o := range oldProducts {
+		o := o
+		n, ok := newProducts[key]
+		if !ok {
+			diffs = append(diffs, productDiff{Key: key, Old: &o})
+			continue
+		}
+		if o.Cost != n.Cost || o.AvailableCount != n.AvailableCount || o.Amount != n.Amount {
+			diffs = append(diffs, productDiff{Key: key, Old: &o, New: &n})
+		}
+	}
+	for key, n := range newProducts {
+		n := n
+		if _, ok := oldProducts[key]; !ok {
+			diffs = append(diffs, productDiff{Key: key, New: &n})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Key < diffs[j].Key })
+	return diffs
+}
+
+// diffRow — строка вывода: пустые значения для отсутствующей стороны.
+func diffRow(d productDiff) []string {
+	vendorCode := ""
+	side := func(st *productState) []string {
+		if st == nil {
+			return []string{"", "", ""}
+		}
+		vendorCode = st.VendorCode
+		return []string{strconv.Itoa(st.Cost), strconv.Itoa(st.AvailableCount), strconv.Itoa(st.Amount)}
+	}
+	o, n := side(d.Old), side(d.New)
+	return []string{d.Key, vendorCode, o[0], n[0], o[1], n[1], o[2], n[2]}
+}
+
+var diffHeader = []string{"product_id/pcs", "vendor_code", "cost_old", "cost_new", "available_old", "available_new", "amount_old", "amount_new"}
+
+func writeDiffCSV(w io.Writer, diffs []productDiff) error {
+	cw := csv.NewWriter(w)
+	cw.Write(diffHeader)
+	for _, d := range diffs {
+		cw.Write(diffRow(d))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeDiffTable(w io.Writer, diffs []productDiff) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Товар\tАртикул\tЦена было\tстало\tНаличие было\tстало\tОстаток было\tстало")
+	for _, d := range diffs {
+		row := diffRow(d)
+		for i, v := range row {
+			if v == "" {
+				row[i] = "—"
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", row[0], row[1], row[2], row[3], row[4], row[5], row[6], row[7])
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "Изменений: %d\n", len(diffs))
+}
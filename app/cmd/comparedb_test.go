@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+// TestReadProductStatesStockAmount: compare-db считает остаток так же, как
+// updateStocks, — с DefaultInStockAmount и AvailabilityMultiplier.
+func TestReadProductStatesStockAmount(t *testing.T) {
+	db, path := newTestDB(t)
+	insertProducts(t, db,
+		testProduct{VendorCode: "box_1_10", ProductID: "1", SKU: "a", Pcs: 10, AvailableCount: 5, Cost: 100},
+		testProduct{VendorCode: "bubblebags_19336_100", ProductID: "bubblebags_19336", SKU: "b", Pcs: 100, AvailableCount: 5, Cost: 200},
+	)
+	cfg := testConfig(t, path)
+	cfg.DefaultInStockAmount = 50
+	cfg.AvailabilityMultiplier = map[string]float64{supplierCargoAvto: 2}
+
+	states, err := readProductStates(cfg, path)
+	if err != nil {
+		t.Fatalf("readProductStates: %v", err)
+	}
+	plan, _, err := buildStockPlan(db, cfg, map[string]int{})
+	if err != nil {
+		t.Fatalf("buildStockPlan: %v", err)
+	}
+	pushed := make(map[string]int)
+	for _, item := range plan {
+		pushed[item.Vendor] = item.Amount
+	}
+
+	want := map[string]int{
+		lastKnownKey("1", 10):                 10, // calcAmount(10, 5) = 5, × 2
+		lastKnownKey("bubblebags_19336", 100): 50, // bubblebags без селектора Availability -> DefaultInStockAmount
+	}
+	for key, amount := range want {
+		st := states[key]
+		if st.Amount != amount {
+			t.Errorf("%s: остаток %d, want %d", key, st.Amount, amount)
+		}
+		if st.Amount != pushed[st.VendorCode] {
+			t.Errorf("%s: compare-db %d, updateStocks отправит %d", key, st.Amount, pushed[st.VendorCode])
+		}
+	}
+}
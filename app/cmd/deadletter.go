@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Этапы, на которых товар может окончательно не обработаться.
+const (
+	stageScrape    = "scrape"     // страницу так и не спарсили, замены из прошлого прогона нет
+	stageConvert   = "convert"    // цену со страницы не удалось перевести в число
+	stagePush      = "push"       // WB не принял пачку с этим SKU
+	stageRejected  = "rejected"   // WB отклонил именно этот SKU
+	stageZeroPrice = "zero_price" // нулевая цена при SkipZeroPrice
+)
+
+// failedItem — запись dead-letter файла.
+type failedItem struct {
+	VendorCode string `json:"vendor_code"`
+	ProductID  string `json:"product_id,omitempty"`
+	SKU        string `json:"sku,omitempty"`
+	Stage      string `json:"stage"`
+	Error      string `json:"error"`
+}
+
+// deadLetterLog собирает окончательные неудачи прогона. Файл можно передать
+// в -product-id-file, чтобы перепарсить только эти товары.
+type deadLetterLog struct {
+	mu    sync.Mutex
+	path  string
+	items []failedItem
+}
+
+// deadLetters заполняется по ходу прогона и пишется рядом со сводкой.
+var deadLetters = &deadLetterLog{}
+
+func (d *deadLetterLog) add(item failedItem) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.items = append(d.items, item)
+}
+
+func (d *deadLetterLog) setPath(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.path = path
+}
+
+// reset очищает список перед новым прогоном в режиме -serve.
+func (d *deadLetterLog) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.items = nil
+}
+
+// write сохраняет файл, даже пустой: иначе остался бы список прошлого прогона.
+func (d *deadLetterLog) write() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.path == "" {
+		return nil
+	}
+	items := d.items
+	if items == nil {
+		items = []failedItem{}
+	}
+	b, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга %s: %v", d.path, err)
+	}
+	if err := os.WriteFile(d.path, b, 0o644); err != nil {
+		return fmt.Errorf("ошибка записи %s: %v", d.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// extraColumns — дополнительные колонки products из Config.ExtraColumns,
+// уже добавленные в БД. Заполняется migrateExtraColumns.
+var extraColumns []string
+
+// Источники значений для ExtraColumns (ключи SaveParams.Extra).
+const (
+	extraBrand     = "brand"      // бренд из карточки WB
+	extraCategory  = "category"   // название предмета WB
+	extraSubjectID = "subject_id" // objectID предмета WB
+	extraSupplier  = "supplier"   // поставщик, с чьей страницы взята цена
+)
+
+var (
+	extraColumnName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	extraColumnType = map[string]bool{"TEXT": true, "INTEGER": true, "REAL": true}
+)
+
+// migrateExtraColumns добавляет в products колонки из конфига (имя -> тип SQLite).
+// Основные колонки переопределять нельзя.
+func migrateExtraColumns(db *sql.DB, columns map[string]string) error {
+	existing, err := tableColumns(db, "products")
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	extraColumns = nil
+	for _, name := range names {
+		typ := strings.ToUpper(strings.TrimSpace(columns[name]))
+		if !extraColumnName.MatchString(name) {
+			return fmt.Errorf("некорректное имя колонки в ExtraColumns: %q", name)
+		}
+		if isCoreColumn(name) {
+			return fmt.Errorf("ExtraColumns[%s]: это основная колонка products", name)
+		}
+		if !extraColumnType[typ] {
+			return fmt.Errorf("ExtraColumns[%s]: неподдерживаемый тип %q (TEXT, INTEGER, REAL)", name, columns[name])
+		}
+		if !existing[name] {
+			if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE products ADD COLUMN %s %s`, name, typ)); err != nil {
+				return fmt.Errorf("ошибка добавления колонки %s: %v", name, err)
+			}
+			log.Printf("В products добавлена колонка %s %s", name, typ)
+		}
+		extraColumns = append(extraColumns, name)
+	}
+	return nil
+}
+
+// coreColumns — колонки products, которыми управляет сам инструмент.
+var coreColumns = map[string]bool{
+	"id": true, "nm_id": true, "vendor_code": true, "pcs": true, "product_id": true,
+	"sku": true, "available_count": true, "cost": true,
+}
+
+func isCoreColumn(name string) bool {
+	if coreColumns[name] {
+		return true
+	}
+	for _, m := range productsMigrations {
+		if m.column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// tableColumns возвращает имена колонок таблицы.
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения схемы %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			ctype   string
+			notNull int
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
+			return nil, fmt.Errorf("ошибка чтения схемы %s: %v", table, err)
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// cardExtra собирает значения для ExtraColumns из карточки WB.
+func cardExtra(card Card, supplier string) map[string]interface{} {
+	extra := map[string]interface{}{
+		extraBrand:     card.Brand,
+		extraCategory:  card.SubjectName,
+		extraSubjectID: card.SubjectID,
+	}
+	if supplier != "" {
+		extra[extraSupplier] = supplier
+	}
+	return extra
+}
+
+// saveExtraColumns пишет в строку products значения настроенных дополнительных колонок.
+func saveExtraColumns(db *sql.DB, params SaveParams) error {
+	var sets []string
+	var args []interface{}
+	for _, col := range extraColumns {
+		v, ok := params.Extra[col]
+		if !ok {
+			continue
+		}
+		sets = append(sets, col+" = ?")
+		args = append(args, v)
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	args = append(args, params.ProductID, params.Pcs)
+	_, err := db.Exec(`UPDATE products SET `+strings.Join(sets, ", ")+` WHERE product_id = ? AND pcs = ?`, args...)
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+)
+
+// lastKnown — последние удачные цена и наличие товара из прошлых прогонов.
+type lastKnown struct {
+	Cost           int
+	AvailableCount int
+}
+
+func lastKnownKey(productID string, pcs int) string {
+	return fmt.Sprintf("%s/%d", productID, pcs)
+}
+
+// loadLastKnown читает последние ненулевые цены из БД прошлого прогона и из
+// истории цен. Вызывается до удаления БД в Process; отсутствие файлов — не ошибка.
+func loadLastKnown(dbName, historyDB string) map[string]lastKnown {
+	known := make(map[string]lastKnown)
+	// Строки идут по возрастанию id, поэтому более свежие перезаписывают старые;
+	// история читается последней
+	sources := []struct{ path, query string }{
+		{dbName, `SELECT product_id, pcs, cost, available_count FROM products WHERE cost > 0 ORDER BY id`},
+		{historyDB, `SELECT product_id, pcs, cost, available_count FROM price_history WHERE cost > 0 ORDER BY id`},
+	}
+	for _, src := range sources {
+		readLastKnown(src.path, src.query, known)
+	}
+	log.Printf("Загружено последних известных цен: %d", len(known))
+	return known
+}
+
+// readLastKnown дописывает в known цены, выбранные query из БД path.
+func readLastKnown(path, query string, known map[string]lastKnown) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		log.Printf("Не удалось открыть %s для последних цен: %v", path, err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		// В старой БД может не быть таблицы
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			productID string
+			pcs       int
+			lk        lastKnown
+		)
+		if err := rows.Scan(&productID, &pcs, &lk.Cost, &lk.AvailableCount); err != nil {
+			log.Printf("Ошибка чтения последней цены: %v", err)
+			continue
+		}
+		known[lastKnownKey(productID, pcs)] = lk
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chromedp/chromedp"
+)
+
+// Бэкенды загрузки страниц поставщиков (Config.ScrapeBackends).
+const (
+	backendChrome = "chrome" // полноценный браузер: JS, клики по вкладкам
+	backendHTTP   = "http"   // простой GET: для страниц, где цена есть в исходном HTML
+)
+
+// pageFields — сырые значения со страницы товара по SupplierSelectors.
+type pageFields struct {
+	Price          string
+	Stock          string // пусто, если у поставщика нет селектора Stock
+	AvailableCount int    // число элементов Availability
+
+	// TierPrices — сырой текст цены ступени по pcs; только найденные ступени.
+	TierPrices map[int]string
+}
+
+// Fetcher загружает страницу товара и читает из неё поля по селекторам.
+// Ошибки — в классах из scrapeerrors.go (ErrPageNotFound, ErrScrapeTimeout, ErrSelectorMissing).
+type Fetcher interface {
+	Fetch(ctx context.Context, url string, sel SupplierSelectors, tiers []int) (pageFields, error)
+}
+
+// fetcherFor выбирает бэкенд поставщика; по умолчанию — chrome.
+func fetcherFor(cfg Config, supplier string) (Fetcher, error) {
+	switch backend := cfg.ScrapeBackends[supplier]; backend {
+	case "", backendChrome:
+		return chromeFetcher{readyTimeout: cfg.ReadyTimeout}, nil
+	case backendHTTP:
+		return httpFetcher{client: scrapeHTTPClient}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный бэкенд парсинга %q для %s", backend, supplier)
+	}
+}
+
+// chromeFetcher работает во вкладке браузера из ctx (см. newChromeContext).
+type chromeFetcher struct {
+	readyTimeout time.Duration // Config.ReadyTimeout; 0 — defaultReadyTimeout
+}
+
+// defaultReadyTimeout — ожидание элемента страницы, если ReadyTimeout не задан.
+const defaultReadyTimeout = 10 * time.Second
+
+// readySettle — пауза после появления элемента: соседние блоки (магазины,
+// ступени цен) часто дорисовываются следом за ним.
+const readySettle = 300 * time.Millisecond
+
+// waitReady ждёт, пока элемент sel станет видимым, но не дольше timeout, и
+// даёт странице readySettle догрузиться. Быстрая страница не ждёт лишнего,
+// медленная — не обрывается на фиксированной паузе. Не дождались — ErrSelectorMissing.
+func waitReady(sel string, timeout time.Duration) chromedp.Action {
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		waitCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if err := chromedp.WaitVisible(sel, chromedp.ByQuery).Do(waitCtx); err != nil {
+			if ctx.Err() == nil && waitCtx.Err() != nil {
+				return fmt.Errorf("%w: %s не появился за %s", ErrSelectorMissing, sel, timeout)
+			}
+			return err
+		}
+		return chromedp.Sleep(readySettle).Do(ctx)
+	})
+}
+
+// defaultAvailabilityRecheck — пауза перед повторным подсчётом Availability.
+const defaultAvailabilityRecheck = 2 * time.Second
+
+// nonZeroDigit — в тексте цены есть значащая цифра, т. е. цена не пустая и не 0.
+var nonZeroDigit = regexp.MustCompile(`[1-9]`)
+
+func (c chromeFetcher) Fetch(ctx context.Context, url string, sel SupplierSelectors, tiers []int) (pageFields, error) {
+	var f pageFields
+	if err := navigate(ctx, url); err != nil {
+		return f, err
+	}
+	if err := checkBlockedChrome(ctx, url, sel); err != nil {
+		return f, err
+	}
+
+	var prepare chromedp.Tasks
+	if sel.Tab == "" {
+		prepare = append(prepare, waitReady(sel.Price, c.readyTimeout))
+	} else {
+		// Кликаем по вкладке, только когда она видима, а не через фиксированную паузу
+		prepare = append(prepare,
+			waitReady(sel.Tab, c.readyTimeout),
+			chromedp.Click(sel.Tab, chromedp.ByQuery),
+		)
+	}
+
+	var read chromedp.Tasks
+	if sel.Stock != "" {
+		read = append(read, requireSelector(sel.Stock), chromedp.Text(sel.Stock, &f.Stock, chromedp.ByQuery))
+	}
+	read = append(read, requireSelector(sel.Price), chromedp.Text(sel.Price, &f.Price, chromedp.ByQuery))
+	countAvailable := chromedp.Evaluate(fmt.Sprintf(`document.querySelectorAll(%q).length`, sel.Availability), &f.AvailableCount)
+	if sel.Availability != "" {
+		if sel.AvailabilityPanel != "" {
+			read = append(read, chromedp.WaitReady(sel.AvailabilityPanel, chromedp.ByQuery))
+		}
+		read = append(read, countAvailable)
+	}
+	// Ступени необязательны: отсутствующая даёт пустую строку, а не ошибку
+	var tierTexts []string
+	if sel.TierPrice != "" {
+		tierTexts = make([]string, len(tiers))
+		for i, pcs := range tiers {
+			js := fmt.Sprintf(`(document.querySelector(%q) || {}).innerText || ""`, fmt.Sprintf(sel.TierPrice, pcs))
+			read = append(read, chromedp.Evaluate(js, &tierTexts[i]))
+		}
+	}
+
+	// После клика ждём цену. Не появилась — не ошибка: ниже кликаем повторно
+	priceMissing := false
+	err := chromedp.Run(ctx, prepare)
+	if err == nil && sel.Tab != "" {
+		err = chromedp.Run(ctx, waitReady(sel.Price, c.readyTimeout))
+		if errors.Is(err, ErrSelectorMissing) && ctx.Err() == nil {
+			priceMissing, err = true, nil
+		}
+	}
+	if err == nil && !priceMissing {
+		err = chromedp.Run(ctx, read)
+	}
+	if err != nil {
+		// Заглушка могла появиться уже после загрузки, вместо вкладок и цены
+		if blockedErr := checkBlockedChrome(ctx, url, sel); blockedErr != nil {
+			return f, blockedErr
+		}
+		return f, classifyScrapeError(url, err)
+	}
+
+	// Клик мог прийти раньше, чем вкладка начала реагировать, — тогда цены нет
+	// или она пустая. Кликаем ещё раз и ждём, пока цена станет видимой.
+	if sel.Tab != "" && (priceMissing || strings.TrimSpace(f.Price) == "") {
+		log.Printf("Нет цены после клика по вкладке на %s, повторяем клик", url)
+		// Ожидание цены ограничено тем же ReadyTimeout, что и первое
+		err = chromedp.Run(ctx,
+			chromedp.Click(sel.Tab, chromedp.ByQuery),
+			waitReady(sel.Price, c.readyTimeout),
+			read,
+		)
+		if err != nil && (ctx.Err() != nil || priceMissing) {
+			return f, classifyScrapeError(url, err)
+		}
+		if err != nil {
+			log.Printf("Повторный клик по вкладке на %s не помог: %v", url, err)
+		}
+	}
+	recount := func(ctx context.Context) (int, error) {
+		err := chromedp.Run(ctx, countAvailable)
+		return f.AvailableCount, err
+	}
+	if err := recountAvailability(ctx, url, &f, sel, recount); err != nil {
+		return f, classifyScrapeError(url, err)
+	}
+
+	for i, text := range tierTexts {
+		if strings.TrimSpace(text) != "" {
+			if f.TierPrices == nil {
+				f.TierPrices = make(map[int]string)
+			}
+			f.TierPrices[tiers[i]] = text
+		}
+	}
+	return f, nil
+}
+
+// recountAvailability пересчитывает магазины один раз через AvailabilityRecheck,
+// если их 0 при ненулевой цене: цена отрисовалась раньше списка магазинов, и 0
+// здесь скорее гонка, чем отсутствие товара. count — подсчёт Availability на
+// открытой странице.
+func recountAvailability(ctx context.Context, url string, f *pageFields, sel SupplierSelectors, count func(context.Context) (int, error)) error {
+	if sel.Availability == "" || f.AvailableCount != 0 || !nonZeroDigit.MatchString(f.Price) {
+		return nil
+	}
+	delay := sel.AvailabilityRecheck
+	if delay <= 0 {
+		delay = defaultAvailabilityRecheck
+	}
+	if err := sleepCtx(ctx, delay); err != nil {
+		return err
+	}
+	n, err := count(ctx)
+	if err != nil {
+		return err
+	}
+	f.AvailableCount = n
+	if n > 0 {
+		log.Printf("Магазины на %s появились после повторного подсчёта: %d", url, n)
+	}
+	return nil
+}
+
+// scrapeHTTPClient — клиент HTTP-бэкенда; общий таймаут задаёт ScrapeTimeout через ctx.
+var scrapeHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// maxPageSize ограничивает размер читаемой страницы.
+const maxPageSize = 10 << 20
+
+// httpFetcher читает HTML без браузера. Вкладки не кликаются: содержимое
+// скрытых вкладок обычно уже есть в разметке.
+type httpFetcher struct {
+	client *http.Client
+}
+
+func (h httpFetcher) Fetch(ctx context.Context, url string, sel SupplierSelectors, tiers []int) (pageFields, error) {
+	var f pageFields
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return f, fmt.Errorf("ошибка создания запроса %s: %v", url, err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return f, classifyScrapeError(url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return f, fmt.Errorf("%w: %s (статус %d)", ErrPageNotFound, url, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return f, fmt.Errorf("ошибка парсинга страницы %s: статус %d", url, resp.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return f, classifyScrapeError(url, err)
+	}
+	if err := checkBlockedHTML(doc, url, sel); err != nil {
+		return f, err
+	}
+
+	text := func(selector string) (string, error) {
+		found := doc.Find(selector)
+		if found.Length() == 0 {
+			return "", fmt.Errorf("ошибка парсинга страницы %s: %w: %s", url, ErrSelectorMissing, selector)
+		}
+		return strings.TrimSpace(found.First().Text()), nil
+	}
+
+	if sel.Stock != "" {
+		if f.Stock, err = text(sel.Stock); err != nil {
+			return f, err
+		}
+	}
+	if f.Price, err = text(sel.Price); err != nil {
+		return f, err
+	}
+	if sel.Availability != "" {
+		f.AvailableCount = doc.Find(sel.Availability).Length()
+	}
+	if sel.TierPrice != "" {
+		for _, pcs := range tiers {
+			if found := doc.Find(fmt.Sprintf(sel.TierPrice, pcs)); found.Length() > 0 {
+				if f.TierPrices == nil {
+					f.TierPrices = make(map[int]string)
+				}
+				f.TierPrices[pcs] = strings.TrimSpace(found.First().Text())
+			}
+		}
+	}
+	return f, nil
+}
+
+// checkBlockedChrome проверяет открытую во вкладке страницу на Blocker и BlockerTexts.
+func checkBlockedChrome(ctx context.Context, url string, sel SupplierSelectors) error {
+	if sel.Blocker == "" && len(sel.BlockerTexts) == 0 {
+		return nil
+	}
+	texts, err := json.Marshal(sel.BlockerTexts)
+	if err != nil {
+		return err
+	}
+	js := fmt.Sprintf(`(() => {
+		const sel = %q;
+		if (sel && document.querySelector(sel)) return sel;
+		const text = document.body ? document.body.innerText : "";
+		return %s.find(t => t && text.includes(t)) || "";
+	})()`, sel.Blocker, texts)
+	var found string
+	if err := chromedp.Run(ctx, chromedp.Evaluate(js, &found)); err != nil {
+		// Не смогли проверить — пусть решает основной парсинг
+		return nil
+	}
+	return blockedError(url, found)
+}
+
+// checkBlockedHTML — то же для HTTP-бэкенда.
+func checkBlockedHTML(doc *goquery.Document, url string, sel SupplierSelectors) error {
+	if sel.Blocker != "" && doc.Find(sel.Blocker).Length() > 0 {
+		return blockedError(url, sel.Blocker)
+	}
+	if len(sel.BlockerTexts) > 0 {
+		text := doc.Text()
+		for _, t := range sel.BlockerTexts {
+			if t != "" && strings.Contains(text, t) {
+				return blockedError(url, t)
+			}
+		}
+	}
+	return nil
+}
+
+// blockedError пишет в лог каждую заглушку: если их много, парсинг надо
+// замедлить (ScrapeDelay, BlockedPause), а не искать ошибку в селекторах.
+func blockedError(url, found string) error {
+	if found == "" {
+		return nil
+	}
+	log.Printf("🚫 Заглушка от ботов на %s (%q)", url, found)
+	summary.update(func(s *runSummary) { s.ScrapeBlocked++ })
+	return fmt.Errorf("%w: %s (%q)", ErrScrapeBlocked, url, found)
+}
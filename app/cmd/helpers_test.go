@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Прогон пишет в лог каждую пачку и товар — в тестах это шум
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testProduct — строка products для тестов отправки остатков.
+type testProduct struct {
+	VendorCode     string
+	ProductID      string
+	SKU            string
+	Pcs            int
+	AvailableCount int
+	Cost           int
+}
+
+// newTestDB создаёт БД со схемой createTable во временной папке теста.
+func newTestDB(t testing.TB) (*sql.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("открытие БД: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	createTable(db)
+	return db, path
+}
+
+func insertProducts(t testing.TB, db *sql.DB, products ...testProduct) {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("начало транзакции: %v", err)
+	}
+	for _, p := range products {
+		_, err := tx.Exec(`
+			INSERT INTO products (vendor_code, product_id, sku, pcs, available_count, cost)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			p.VendorCode, p.ProductID, p.SKU, p.Pcs, p.AvailableCount, p.Cost)
+		if err != nil {
+			tx.Rollback()
+			t.Fatalf("вставка %s: %v", p.VendorCode, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("фиксация транзакции: %v", err)
+	}
+}
+
+// testConfig — конфиг с файлами во временной папке и без ожидания лимитера WB.
+func testConfig(t testing.TB, dbPath string) Config {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := Config{
+		DBName:         dbPath,
+		PriceHistoryDB: filepath.Join(dir, "price_history.db"),
+		StockStatePath: filepath.Join(dir, "last_stocks.json"),
+		FailedPath:     filepath.Join(dir, "failed.json"),
+		RateLimits:     map[string]int{wbEndpointStocks: 600000},
+	}
+	cfg.setDefaults()
+	return cfg
+}
+
+// findChrome ищет Chrome/Chromium в PATH; без него тест пропускается.
+func findChrome(t testing.TB) string {
+	t.Helper()
+	for _, name := range []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "headless_shell"} {
+		if p, err := exec.LookPath(name); err == nil {
+			return p
+		}
+	}
+	t.Skip("Chrome не найден")
+	return ""
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// PriceSnapshot — одна точка истории цены и наличия товара.
+type PriceSnapshot struct {
+	ProductID      string
+	Pcs            int
+	Cost           int
+	AvailableCount int
+	ScrapedAt      time.Time
+}
+
+// priceHistoryDB — БД истории цен (Config.PriceHistoryDB) на время Process.
+// Открыта отдельно от DBName: ту Process удаляет перед каждым полным прогоном.
+var priceHistoryDB *sql.DB
+
+// openPriceHistory открывает БД истории цен и создаёт в ней price_history.
+func openPriceHistory(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при открытии БД истории цен: %v", err)
+	}
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS price_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			product_id TEXT,
+			pcs INTEGER,
+			cost INTEGER,
+			available_count INTEGER,
+			scraped_at TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_price_history_product ON price_history (product_id, pcs, scraped_at)`,
+	}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("ошибка при создании price_history в %s: %v", path, err)
+		}
+	}
+	return db, nil
+}
+
+// appendPriceHistory дописывает снимок в price_history. В отличие от products,
+// строки здесь никогда не перезаписываются. Без открытой БД истории (nil) —
+// ничего не делает.
+func appendPriceHistory(db *sql.DB, productID string, pcs, cost, availableCount int) error {
+	if db == nil {
+		return nil
+	}
+	_, err := db.Exec(`
+		INSERT INTO price_history (product_id, pcs, cost, available_count, scraped_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		productID, pcs, cost, availableCount, time.Now().UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+// PriceHistory возвращает историю цен товара по всем pcs в порядке времени.
+func PriceHistory(db *sql.DB, productID string) ([]PriceSnapshot, error) {
+	rows, err := db.Query(`
+		SELECT product_id, pcs, cost, available_count, scraped_at
+		FROM price_history
+		WHERE product_id = ?
+		ORDER BY scraped_at, id`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при запросе истории цен: %v", err)
+	}
+	defer rows.Close()
+
+	var history []PriceSnapshot
+	for rows.Next() {
+		var (
+			snap      PriceSnapshot
+			scrapedAt string
+		)
+		if err := rows.Scan(&snap.ProductID, &snap.Pcs, &snap.Cost, &snap.AvailableCount, &scrapedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения истории цен: %v", err)
+		}
+		snap.ScrapedAt, err = time.Parse(time.RFC3339, scrapedAt)
+		if err != nil {
+			return nil, fmt.Errorf("некорректное время %q в истории цен: %v", scrapedAt, err)
+		}
+		history = append(history, snap)
+	}
+	return history, rows.Err()
+}
+
+// runHistory печатает историю цен товаров: history <productID>...
+func runHistory(cfg Config, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("использование: history <productID>...")
+	}
+	if _, err := os.Stat(cfg.PriceHistoryDB); err != nil {
+		return fmt.Errorf("нет БД истории цен: %v", err)
+	}
+	db, err := sql.Open("sqlite", cfg.PriceHistoryDB)
+	if err != nil {
+		return fmt.Errorf("ошибка при открытии БД истории цен: %v", err)
+	}
+	defer db.Close()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "productID\tpcs\tцена\tналичие\tвремя")
+	for _, productID := range fs.Args() {
+		history, err := PriceHistory(db, productID)
+		if err != nil {
+			return err
+		}
+		for _, snap := range history {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", snap.ProductID, snap.Pcs, snap.Cost, snap.AvailableCount,
+				snap.ScrapedAt.Local().Format("2006-01-02 15:04"))
+		}
+	}
+	return tw.Flush()
+}
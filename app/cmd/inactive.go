@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// setActive включает или выключает товары по vendorCode. Выключенные товары
+// остаются в БД, но updateStocks их не отправляет — "больше не продаём"
+// в отличие от "временно нет в наличии" (нулевой остаток).
+func setActive(dbName string, vendorCodes []string, active bool) error {
+	db, err := sql.Open("sqlite", dbName)
+	if err != nil {
+		return fmt.Errorf("ошибка при открытии базы данных: %v", err)
+	}
+	defer db.Close()
+	createTable(db)
+
+	for _, vc := range vendorCodes {
+		res, err := db.Exec(`UPDATE products SET active = ? WHERE vendor_code = ?`, active, vc)
+		if err != nil {
+			return fmt.Errorf("vendorCode=%s: ошибка обновления active: %v", vc, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			log.Printf("vendorCode=%s: товар не найден в %s", vc, dbName)
+			continue
+		}
+		log.Printf("vendorCode=%s: active=%t", vc, active)
+	}
+	return nil
+}
+
+// splitVendorCodes разбирает список артикулов через запятую.
+func splitVendorCodes(s string) []string {
+	var codes []string
+	for _, vc := range strings.Split(s, ",") {
+		if vc = strings.TrimSpace(vc); vc != "" {
+			codes = append(codes, vc)
+		}
+	}
+	return codes
+}
+
+// loadInactive читает выключенные артикулы из БД прошлого прогона, чтобы
+// Process перенёс флаг в пересозданную БД. Отсутствие файла — не ошибка.
+func loadInactive(dbName string) map[string]bool {
+	inactive := make(map[string]bool)
+	if _, err := os.Stat(dbName); err != nil {
+		return inactive
+	}
+	db, err := sql.Open("sqlite", dbName)
+	if err != nil {
+		log.Printf("Не удалось открыть старую БД для выключенных товаров: %v", err)
+		return inactive
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT vendor_code FROM products WHERE active = 0`)
+	if err != nil {
+		// В старой БД может не быть колонки active
+		return inactive
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var vc string
+		if err := rows.Scan(&vc); err == nil {
+			inactive[vc] = true
+		}
+	}
+	return inactive
+}
+
+// restoreInactive снова выключает товары, выключенные в прошлой БД.
+func restoreInactive(db *sql.DB, inactive map[string]bool) {
+	for vc := range inactive {
+		if _, err := db.Exec(`UPDATE products SET active = 0 WHERE vendor_code = ?`, vc); err != nil {
+			log.Printf("vendorCode=%s: не удалось сохранить active=false: %v", vc, err)
+		}
+	}
+	if len(inactive) > 0 {
+		log.Printf("Выключенных товаров: %d", len(inactive))
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// debugLogging включает подробные сообщения (флаг -debug): каждую попытку
+// повтора и т. п. Без него в лог попадает только итог операции.
+var debugLogging bool
+
+func debugf(format string, args ...interface{}) {
+	if debugLogging {
+		log.Printf("[debug] "+format, args...)
+	}
+}
+
+// logRecovered предупреждает, что операция удалась не с первой попытки.
+// Отдельные попытки пишутся только в debug, а окончательная неудача
+// возвращается ошибкой с числом попыток (см. retryError) и логируется вызывающим.
+func logRecovered(op string, attempts int) {
+	if attempts > 1 {
+		log.Printf("⚠️ %s: удалось с %d-й попытки", op, attempts)
+	}
+}
+
+// retryError добавляет к последней ошибке число сделанных попыток.
+func retryError(attempts int, err error) error {
+	if attempts <= 1 {
+		return err
+	}
+	return fmt.Errorf("после %d попыток: %w", attempts, err)
+}
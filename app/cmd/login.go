@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/chromedp/chromedp"
+)
+
+// SupplierLogin — вход в оптовый кабинет поставщика, без которого он не
+// показывает цены. Выполняется один раз за запуск браузера, до парсинга;
+// cookies общие для всех вкладок. Чтобы вход переживал перезапуск, задайте
+// ChromeUserDataDir: cookies сохранятся в профиле, и повторный вход не понадобится.
+type SupplierLogin struct {
+	LoginURL string // страница с формой входа
+	Username string
+	Password string `json:"-"` // не печатается в -config-dump
+
+	UsernameSelector string // поле логина
+	PasswordSelector string // поле пароля
+	SubmitSelector   string // кнопка "Войти"
+
+	// LoggedInSelector — элемент, который есть только у вошедшего пользователя
+	// (ссылка "Выйти", имя в шапке). По нему вход проверяется до и после отправки формы.
+	LoggedInSelector string
+}
+
+// validate проверяет, что заданы все поля, без которых вход не выполнить.
+func (l SupplierLogin) validate(supplier string) error {
+	for name, v := range map[string]string{
+		"LoginURL": l.LoginURL, "Username": l.Username, "Password": l.Password,
+		"UsernameSelector": l.UsernameSelector, "PasswordSelector": l.PasswordSelector,
+		"SubmitSelector": l.SubmitSelector, "LoggedInSelector": l.LoggedInSelector,
+	} {
+		if v == "" {
+			return fmt.Errorf("SupplierLogins[%q]: не задан %s", supplier, name)
+		}
+	}
+	return nil
+}
+
+// loginSuppliers входит в кабинеты всех поставщиков из SupplierLogins во
+// вкладке ctx. Ошибка входа останавливает прогон: без него цены были бы
+// розничными или пустыми. HTTP-бэкенд (ScrapeBackends) cookies браузера не видит.
+func loginSuppliers(ctx context.Context, cfg Config) error {
+	suppliers := make([]string, 0, len(cfg.SupplierLogins))
+	for s := range cfg.SupplierLogins {
+		suppliers = append(suppliers, s)
+	}
+	sort.Strings(suppliers)
+	for _, s := range suppliers {
+		if err := loginSupplier(ctx, cfg, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loginSupplier(ctx context.Context, cfg Config, supplier string) error {
+	l := cfg.SupplierLogins[supplier]
+	if err := l.validate(supplier); err != nil {
+		return err
+	}
+	if err := navigate(ctx, l.LoginURL); err != nil {
+		return fmt.Errorf("вход %s: %w", supplier, err)
+	}
+
+	// Профиль из ChromeUserDataDir может быть уже авторизован
+	var loggedIn bool
+	js := fmt.Sprintf(`document.querySelector(%q) !== null`, l.LoggedInSelector)
+	if err := chromedp.Run(ctx, chromedp.Evaluate(js, &loggedIn)); err != nil {
+		return fmt.Errorf("вход %s: %w", supplier, classifyScrapeError(l.LoginURL, err))
+	}
+	if loggedIn {
+		log.Printf("🔑 %s: уже авторизованы", supplier)
+		return nil
+	}
+
+	err := chromedp.Run(ctx,
+		waitReady(l.UsernameSelector, cfg.ReadyTimeout),
+		chromedp.SendKeys(l.UsernameSelector, l.Username, chromedp.ByQuery),
+		chromedp.SendKeys(l.PasswordSelector, l.Password, chromedp.ByQuery),
+		chromedp.Click(l.SubmitSelector, chromedp.ByQuery),
+		waitReady(l.LoggedInSelector, cfg.ReadyTimeout),
+	)
+	if errors.Is(err, ErrSelectorMissing) {
+		return fmt.Errorf("вход %s не удался, проверьте логин, пароль и селекторы: %w", supplier, err)
+	}
+	if err != nil {
+		return fmt.Errorf("вход %s: %w", supplier, classifyScrapeError(l.LoginURL, err))
+	}
+	log.Printf("🔑 %s: вход выполнен как %s", supplier, l.Username)
+	return nil
+}
@@ -6,43 +6,77 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/chromedp/chromedp"
 	"github.com/xuri/excelize/v2"
 	_ "modernc.org/sqlite"
 )
 
 const (
-	WBAPINUrl    = "https://marketplace-api.wildberries.ru/api/v3/stocks/%d"
-	WarehouseID  = 1283008
-	BatchSize    = 1000
-	RequestLimit = 300
+	WBAPINUrl      = "https://marketplace-api.wildberries.ru/api/v3/stocks/%d"
+	WBCardsListURL = "https://content-api.wildberries.ru/content/v2/get/cards/list"
+	WBPricesURL    = "https://discounts-prices-api.wildberries.ru/api/v2/upload/task"
+	WarehouseID    = 1283008
+	BatchSize      = 1000
+	RequestLimit   = 300
 )
 
+// maxWorkers — верхняя граница -scrape-workers и -push-workers. Больше не имеет
+// смысла: упрёмся в лимиты WB и защиту поставщиков от ботов.
+const maxWorkers = 32
+
+// maxRuntimeGrace — сколько ждать после -max-runtime, прежде чем выйти принудительно.
+const maxRuntimeGrace = 30 * time.Second
+
 var bubblebagsURLMap = make(map[string]string)
 
 func main() {
-	apiKey := os.Getenv("WB_API_KEY")
-	if apiKey == "" {
-		log.Fatal("Перед запуском необходимо установить переменную окружения API_KEY")
-	}
-	if err := loadBubblebagsCSV(); err != nil {
-		log.Fatalf("Ошибка загрузки URL из CSV: %v", err)
-	}
-
-	if err := loadDownloadData(); err != nil {
-		log.Fatalf("Ошибка чтения download.csv: %v", err)
+	summaryPath := flag.String("summary", "summary.json", "путь к JSON-сводке прогона")
+	configDump := flag.Bool("config-dump", false, "вывести итоговую конфигурацию и выйти")
+	cacheCards := flag.String("cache-cards", "", "JSON-файл для кеша карточек WB (пусто — без кеша)")
+	cacheTTL := flag.Duration("cache-ttl", time.Hour, "сколько действителен кеш карточек")
+	doScrape := flag.Bool("scrape", false, "спарсить цены и наличие и сохранить в БД")
+	doPushStock := flag.Bool("push-stock", false, "отправить остатки из БД в WB")
+	doPushPrice := flag.Bool("push-price", false, "выгрузить цены из БД в export_product_cost_data.xlsx")
+	urlsCSV := flag.String("urls-csv", "urls.csv", "CSV с адресами страниц bubblebags (артикул,URL)")
+	exportStocks := flag.String("export-stocks", "", "сохранить план остатков из БД в XLSX для ручной загрузки в WB")
+	maxRuntime := flag.Duration("max-runtime", 0, "прервать прогон, если он длится дольше (0 — без ограничения)")
+	scrapeWorkers := flag.Int("scrape-workers", 0, fmt.Sprintf("сколько страниц парсить одновременно, 1..%d (0 — из конфига)", maxWorkers))
+	pushWorkers := flag.Int("push-workers", 0, fmt.Sprintf("сколько пачек остатков отправлять одновременно, 1..%d (0 — из конфига)", maxWorkers))
+	deactivate := flag.String("deactivate", "", "выключить товары (vendorCode через запятую): остатки по ним больше не отправляются")
+	activate := flag.String("activate", "", "снова включить товары, выключенные -deactivate")
+	debug := flag.Bool("debug", false, "подробный лог: каждая попытка повтора и т. п.")
+	resume := flag.Bool("resume", false, "продолжить прерванный прогон, пропуская уже спарсенные товары")
+	skippedExport := flag.String("skipped-export", "", "выгрузить товары, не дошедшие до WB, с причиной (.csv или .json)")
+	showProgress := flag.Bool("progress", false, "показывать прогресс парсинга и отправки остатков")
+	safe := flag.Bool("safe", false, "безопасный режим: без отправки в WB, на копии БД, с подробным логом")
+	allowEmpty := flag.Bool("allow-empty", false, "отправлять остатки, даже если парсинг не сохранил ни одного товара")
+	serveAddr := flag.String("serve", "", "запустить HTTP-сервер (например, :8080): POST /run — прогон, GET /status — итог последнего")
+	productIDFile := flag.String("product-id-file", "", "файл со списком productID: парсить только их, не пересоздавая БД")
+	flag.Parse()
+	debugLogging = *debug
+
+	// Без явных шагов работаем как раньше: парсинг + выгрузка цен в XLSX.
+	// Остатки в WB уходят только с явным -push-stock
+	if !*doScrape && !*doPushStock && !*doPushPrice && *exportStocks == "" {
+		*doScrape, *doPushPrice = true, true
 	}
 
 	cfg := Config{
@@ -65,24 +99,287 @@ func main() {
 			"^bubblebags_9\\d+_\\d+$",
 			"^bubblebags_1\\d+_\\d+$",
 		},
+		// Коробки (3979) не бывают bubblebags — проверяем только box_
+		PatternsByObjectID: map[int][]string{
+			3979: {"^box_\\d+_\\d+$"},
+		},
 		UsePcs: true,
+
+		BubblebagsCSV:  *urlsCSV,
+		CardsCachePath: *cacheCards,
+		CardsCacheTTL:  *cacheTTL,
+		ProductIDFile:  *productIDFile,
+		Resume:         *resume,
+		AllowEmpty:     *allowEmpty,
+		Progress:       *showProgress,
+
+		SkippedExportPath: *skippedExport,
+	}
+	if err := applyWorkerFlags(&cfg, *scrapeWorkers, *pushWorkers); err != nil {
+		log.Fatalf("Некорректное число воркеров: %v", err)
+	}
+	cfg.setDefaults()
+	if err := cfg.applyWorkDir(); err != nil {
+		log.Fatalf("Ошибка подготовки WorkDir: %v", err)
+	}
+	if *safe {
+		if err := applySafeMode(&cfg); err != nil {
+			log.Fatalf("%v", err)
+		}
 	}
+	*summaryPath = cfg.inWorkDir(*summaryPath)
+	if *exportStocks != "" {
+		*exportStocks = cfg.inWorkDir(*exportStocks)
+	}
+	deadLetters.setPath(cfg.FailedPath)
+	skipped.setPath(cfg.SkippedExportPath)
 
-	err := Process(apiKey, cfg)
-	if err != nil {
-		log.Fatalf("Ошибка при обработке: %v", err)
+	apiKey := os.Getenv("WB_API_KEY")
+	if *configDump {
+		if err := dumpConfig(os.Stdout, cfg, apiKey); err != nil {
+			log.Fatalf("Ошибка вывода конфигурации: %v", err)
+		}
+		return
 	}
 
-	// err = updateStocks(apiKey, cfg)
-	// if err != nil {
-	// 	log.Fatalf("Ошибка при обновлении стоки: %v", err)
-	// }
+	if *deactivate != "" || *activate != "" {
+		if err := setActive(cfg.DBName, splitVendorCodes(*deactivate), false); err != nil {
+			log.Fatalf("Ошибка выключения товаров: %v", err)
+		}
+		if err := setActive(cfg.DBName, splitVendorCodes(*activate), true); err != nil {
+			log.Fatalf("Ошибка включения товаров: %v", err)
+		}
+		return
+	}
+
+	if cfg.AmountTablePath != "" {
+		table, err := loadAmountTable(cfg.AmountTablePath)
+		if err != nil {
+			log.Fatalf("Ошибка загрузки таблицы остатков: %v", err)
+		}
+		amountTable = table
+	}
+
+	switch flag.Arg(0) {
+	case "compare-db":
+		if err := runCompareDB(cfg, flag.Args()[1:]); err != nil {
+			log.Fatalf("Ошибка сравнения БД: %v", err)
+		}
+		return
+	case "check-selectors":
+		if err := runCheckSelectors(cfg, flag.Args()[1:]); err != nil {
+			log.Fatalf("Ошибка проверки селекторов: %v", err)
+		}
+		return
+	case "recompute":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := runRecompute(ctx, cfg, apiKey, flag.Args()[1:]); err != nil {
+			log.Fatalf("Ошибка пересчёта: %v", err)
+		}
+		writeSummary(*summaryPath)
+		return
+	case "history":
+		if err := runHistory(cfg, flag.Args()[1:]); err != nil {
+			log.Fatalf("Ошибка вывода истории цен: %v", err)
+		}
+		return
+	case "selftest":
+		if err := runSelftest(cfg, apiKey); err != nil {
+			log.Fatalf("Самопроверка не пройдена: %v", err)
+		}
+		return
+	default:
+		// Опечатка в подкоманде не должна запускать полный конвейер
+		if flag.NArg() > 0 {
+			log.Fatalf("Неизвестная подкоманда %q; доступны: compare-db, check-selectors, recompute, history, selftest", flag.Arg(0))
+		}
+	}
+
+	if apiKey == "" {
+		log.Fatal("Перед запуском необходимо установить переменную окружения API_KEY")
+	}
+	if *doScrape && *serveAddr == "" {
+		if err := loadScrapeInputs(cfg); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
+	// Корневой контекст: Ctrl+C / SIGTERM прерывает и парсинг, и запросы к WB
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *serveAddr != "" {
+		srv := &runServer{apiKey: apiKey, cfg: cfg, summaryPath: *summaryPath, maxRuntime: *maxRuntime}
+		if err := srv.listen(ctx, *serveAddr); err != nil {
+			log.Fatalf("Ошибка HTTP-сервера: %v", err)
+		}
+		return
+	}
+
+	// Ограничение по времени: по истечении отменяем контекст, шаги сворачиваются
+	// с тем, что успели сохранить. Если что-то не реагирует на отмену (завис Chrome),
+	// через maxRuntimeGrace процесс завершается принудительно.
+	if *maxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *maxRuntime)
+		defer cancel()
+		watchdog := time.AfterFunc(*maxRuntime+maxRuntimeGrace, func() {
+			err := fmt.Errorf("прогон не завершился за -max-runtime=%s, принудительный выход", *maxRuntime)
+			summary.addError(err)
+			writeSummary(*summaryPath)
+			notifyRun(cfg, err)
+			log.Fatalf("Прогон не завершился за %s + %s, выходим принудительно", *maxRuntime, maxRuntimeGrace)
+		})
+		defer watchdog.Stop()
+	}
+
+	if *doScrape {
+		result, err := Process(ctx, apiKey, cfg)
+		log.Printf("Итог парсинга: %s", result)
+		if err != nil {
+			summary.addError(err)
+			writeSummary(*summaryPath)
+			notifyRun(cfg, err)
+			log.Fatalf("Ошибка при обработке: %v", err)
+		}
+		if err := checkScrapeFailureRate(cfg); err != nil {
+			summary.addError(err)
+			writeSummary(*summaryPath)
+			notifyRun(cfg, err)
+			log.Fatalf("Прогон остановлен: %v", err)
+		}
+	}
+
+	if *doPushStock {
+		result, err := updateStocks(ctx, apiKey, cfg)
+		log.Printf("Итог отправки остатков: %s", result)
+		if err != nil {
+			summary.addError(err)
+			writeSummary(*summaryPath)
+			notifyRun(cfg, err)
+			log.Fatalf("Ошибка при обновлении стоки: %v", err)
+		}
+	}
+
+	if *exportStocks != "" {
+		if err := exportStockPlanXLSX(cfg, *exportStocks); err != nil {
+			summary.addError(err)
+			log.Printf("Ошибка выгрузки плана остатков: %v", err)
+		}
+	}
 
 	// if err := ozonUpdateStocks(cfg); err != nil {
 	// 	fmt.Printf("Ошибка обновления остатков: %v\n", err)
 	// }
 
-	updateXLSXPrices(cfg, "export_product_cost_data.xlsx")
+	if *doPushPrice {
+		if err := updateXLSXPrices(cfg, "export_product_cost_data.xlsx"); err != nil {
+			summary.addError(err)
+			log.Printf("Ошибка при обновлении цен: %v", err)
+		}
+	}
+	writeSummary(*summaryPath)
+	notifyRun(cfg, nil)
+}
+
+// dumpConfig печатает итоговую конфигурацию в JSON, скрывая API-ключ.
+func dumpConfig(w io.Writer, cfg Config, apiKey string) error {
+	redacted := "<не задан>"
+	if apiKey != "" {
+		redacted = "<скрыт>"
+	}
+	dump := struct {
+		APIKey       string
+		WarehouseID  int
+		BatchSize    int
+		RequestLimit int
+		Config       Config
+	}{redacted, WarehouseID, BatchSize, RequestLimit, cfg}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dump)
+}
+
+// applyWorkerFlags переопределяет размеры пулов из флагов; 0 — оставить как в конфиге.
+func applyWorkerFlags(cfg *Config, scrapeWorkers, pushWorkers int) error {
+	if scrapeWorkers != 0 {
+		if scrapeWorkers < 1 || scrapeWorkers > maxWorkers {
+			return fmt.Errorf("-scrape-workers=%d вне диапазона 1..%d", scrapeWorkers, maxWorkers)
+		}
+		cfg.ScrapeWorkers = scrapeWorkers
+	}
+	if pushWorkers != 0 {
+		if pushWorkers < 1 || pushWorkers > maxWorkers {
+			return fmt.Errorf("-push-workers=%d вне диапазона 1..%d", pushWorkers, maxWorkers)
+		}
+		cfg.PushConcurrency = pushWorkers
+	}
+	return nil
+}
+
+// loadScrapeInputs читает файлы, нужные парсингу: адреса bubblebags и download.csv.
+// Карты пересоздаются, чтобы повторный прогон в -serve не видел удалённые строки.
+func loadScrapeInputs(cfg Config) error {
+	bubblebagsURLMap = make(map[string]string)
+	downloadCSVData = make(map[int]DownloadRow)
+	if usesBubblebags(cfg) {
+		if err := loadBubblebagsCSV(cfg.BubblebagsCSV); err != nil {
+			return fmt.Errorf("ошибка загрузки URL из CSV: %v", err)
+		}
+	}
+	if err := loadDownloadData(); err != nil {
+		return fmt.Errorf("ошибка чтения download.csv: %v", err)
+	}
+	return nil
+}
+
+// ErrEmptyRun — парсинг в этом прогоне не сохранил ни одного товара.
+var ErrEmptyRun = errors.New("прогон не сохранил ни одного товара")
+
+// checkRunNotEmpty не даёт отправить остатки, если Process в этом прогоне ничего
+// не сохранил (сломанные шаблоны, все страницы с ошибкой): в БД тогда либо пусто,
+// либо данные прошлых прогонов. Строки, спарсенные до -resume, Process переносит
+// в этот прогон (adoptDone). -allow-empty снимает проверку. Без парсинга
+// (-push-stock отдельно) runID пуст и проверять нечего.
+func checkRunNotEmpty(db *sql.DB, cfg Config) error {
+	if runID == "" || cfg.AllowEmpty {
+		return nil
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM products WHERE run_id = ?`, runID).Scan(&n); err != nil {
+		return fmt.Errorf("ошибка подсчёта товаров прогона: %v", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w (run_id=%s), остатки не отправляются; -allow-empty, чтобы отправить всё равно", ErrEmptyRun, runID)
+	}
+	return nil
+}
+
+// checkScrapeFailureRate останавливает прогон перед отправкой остатков, если
+// не спарсилась большая часть страниц (сайт лежит, селекторы сломались):
+// отправлять остальное вместе с кучей нулей опаснее, чем не отправлять ничего.
+func checkScrapeFailureRate(cfg Config) error {
+	if rate := summary.scrapeFailureRate(); cfg.MaxScrapeFailureRate > 0 && rate > cfg.MaxScrapeFailureRate {
+		return fmt.Errorf("доля ошибок парсинга %.0f%% больше MaxScrapeFailureRate %.0f%%, остатки не отправляются",
+			rate*100, cfg.MaxScrapeFailureRate*100)
+	}
+	return nil
+}
+
+func writeSummary(path string) {
+	if err := deadLetters.write(); err != nil {
+		log.Printf("Не удалось сохранить список неудач: %v", err)
+	}
+	if err := skipped.write(deadLetters); err != nil {
+		log.Printf("Не удалось сохранить выгрузку пропущенных товаров: %v", err)
+	}
+	if err := summary.write(path); err != nil {
+		log.Printf("Не удалось сохранить сводку: %v", err)
+		return
+	}
+	log.Printf("Сводка прогона сохранена в %s", path)
 }
 func loadDownloadData() error {
 	f, err := os.Open("download.csv")
@@ -128,44 +425,241 @@ func loadDownloadData() error {
 	return nil
 }
 
-func loadBubblebagsCSV() error {
-	file, err := os.Open("urls.csv")
+// usesBubblebags сообщает, есть ли среди шаблонов bubblebags — только им нужен CSV с адресами.
+func usesBubblebags(cfg Config) bool {
+	for _, pattern := range cfg.VendorCodePatterns {
+		if strings.Contains(pattern, supplierBubblebags) {
+			return true
+		}
+	}
+	for _, patterns := range cfg.PatternsByObjectID {
+		for _, pattern := range patterns {
+			if strings.Contains(pattern, supplierBubblebags) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// patternsFor возвращает шаблоны артикулов для предмета WB: из PatternsByObjectID,
+// если предмет там есть, иначе общие VendorCodePatterns.
+func patternsFor(cfg Config, subjectID int) []string {
+	if patterns, ok := cfg.PatternsByObjectID[subjectID]; ok {
+		return patterns
+	}
+	return cfg.VendorCodePatterns
+}
+
+func loadBubblebagsCSV(path string) error {
+	file, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("ошибка при открытии файла urls.csv: %v", err)
+		return fmt.Errorf("ошибка при открытии файла %s: %v", path, err)
 	}
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
+	var invalid []string
+	lineNum := 0
 	for scanner.Scan() {
+		lineNum++
 		line := scanner.Text()
 		parts := strings.Split(line, ",")
 		if len(parts) == 2 {
 			// Пример: "bubblebags_19323,https://packio.ru/product/paket..."
-			bubblebagsURLMap[parts[0]] = parts[1]
+			pageURL, err := normalizeURL(parts[1])
+			if err != nil {
+				invalid = append(invalid, fmt.Sprintf("строка %d (%s): %v", lineNum, strings.TrimSpace(parts[0]), err))
+				continue
+			}
+			bubblebagsURLMap[strings.TrimSpace(parts[0])] = pageURL
 		}
 	}
-	return scanner.Err()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("некорректные URL в %s:\n%s", path, strings.Join(invalid, "\n"))
+	}
+	return nil
 }
 
-func updateStocks(apiKey string, cfg Config) error {
+// normalizeURL чистит URL из CSV: убирает пробелы, добавляет https://,
+// если схемы нет, и проверяет, что получился абсолютный http(s)-адрес.
+func normalizeURL(raw string) (string, error) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return "", fmt.Errorf("пустой URL")
+	}
+	if !strings.Contains(s, "://") {
+		s = "https://" + strings.TrimPrefix(s, "//")
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("не удалось разобрать URL %q: %v", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("неподдерживаемая схема %q в URL %q", u.Scheme, raw)
+	}
+	if u.Host == "" || strings.ContainsAny(u.Host, " \t") {
+		return "", fmt.Errorf("нет хоста в URL %q", raw)
+	}
+	return u.String(), nil
+}
+
+func updateStocks(ctx context.Context, apiKey string, cfg Config) (PushResult, error) {
+	cfg.setDefaults()
 	db, err := sql.Open("sqlite", cfg.DBName)
 	if err != nil {
-		return fmt.Errorf("ошибка при открытии базы данных: %v", err)
+		return PushResult{}, fmt.Errorf("ошибка при открытии базы данных: %v", err)
 	}
 	defer db.Close()
+	if err := validateSchema(db); err != nil {
+		return PushResult{}, fmt.Errorf("%s: %w", cfg.DBName, err)
+	}
 
+	if !validOutOfStockPolicy(cfg.OutOfStockPolicy) {
+		return PushResult{}, fmt.Errorf("неизвестная OutOfStockPolicy: %q", cfg.OutOfStockPolicy)
+	}
+	if err := checkRunNotEmpty(db, cfg); err != nil {
+		return PushResult{}, err
+	}
+	lastStocks, err := loadLastStocks(cfg.StockStatePath)
+	if err != nil {
+		return PushResult{}, err
+	}
+
+	stocksData, skippedRows, err := buildStockPlan(db, cfg, lastStocks)
+	if err != nil {
+		return PushResult{}, err
+	}
+	if cfg.MinAmountDelta > 0 {
+		var unchanged int
+		stocksData, unchanged = filterSmallDeltas(stocksData, lastStocks, cfg.MinAmountDelta)
+		log.Printf("Не отправляем SKU с изменением остатка меньше %d: %d", cfg.MinAmountDelta, unchanged)
+		skippedRows += unchanged
+	}
+	stocksData, dups := dedupStockItems(stocksData)
+	if dups > 0 {
+		log.Printf("Повторы SKU в плане остатков, отправляются один раз: %d", dups)
+		skippedRows += dups
+	}
+	summary.update(func(s *runSummary) { s.SKUsSkipped += skippedRows })
+	warnSuspiciousSKUs(db, stocksData)
+
+	// Лимитеры клиента общие для всех воркеров (для соблюдения 300 в минуту)
+	client := newWBClient(apiKey, cfg)
+	defer client.Close()
+
+	concurrency := cfg.PushConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// 4) Отправляем запросы по BATCH_SIZE = 1000
+	total := len(stocksData)
+	log.Printf("Всего товаров для отправки: %d (параллельно запросов: %d)\n", total, concurrency)
+
+	batches := make(chan []stockItem)
+	result := &pushResult{}
+	bar := newProgressBar(cfg.Progress, "Остатки", total)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				// С мёртвым токеном остальные пачки отправлять бессмысленно
+				if result.authError() != nil {
+					result.addSkipped(len(batch))
+					continue
+				}
+				pushStockBatch(ctx, client, batch, result)
+				bar.add(len(batch))
+			}
+		}()
+	}
+
+	all := splitBatches(stocksData, BatchSize)
+	for i, batch := range all {
+		if i > 0 && cfg.BatchDelay > 0 {
+			if err := sleepCtx(ctx, cfg.BatchDelay); err != nil {
+				// Оставшиеся пачки не отправлены — считаем их неудачными
+				for _, rest := range all[i:] {
+					result.addSkipped(len(rest))
+				}
+				log.Printf("Отправка остатков прервана: %v", err)
+				break
+			}
+		}
+		batches <- batch
+	}
+	close(batches)
+	wg.Wait()
+	bar.finish()
+
+	log.Printf("Готово! Пачек отправлено: %d, с ошибкой: %d; товаров обновлено: %d, не обновлено: %d",
+		result.Batches, result.FailedBatches, result.Updated, result.Failed)
+	markRejectedSKUs(db, result.Rejected)
+	for sku, amount := range result.sent {
+		lastStocks[sku] = amount
+	}
+	var deleted int
+	if result.authError() == nil {
+		for _, sku := range deleteInactiveStocks(ctx, db, client) {
+			delete(lastStocks, sku)
+			deleted++
+		}
+	}
+	// В DryRun ничего не отправлено — прошлые остатки остаются актуальными
+	if !cfg.DryRun {
+		if err := saveLastStocks(cfg.StockStatePath, lastStocks); err != nil {
+			log.Printf("Не удалось сохранить отправленные остатки: %v", err)
+		}
+	}
+	summary.update(func(s *runSummary) {
+		s.BatchesSent += result.Batches
+		s.SKUsUpdated += result.Updated
+		s.SKUsFailed += result.Failed
+		s.SKUsDryRun += result.DryRun
+		s.Errors = append(s.Errors, result.Errors...)
+	})
+	pr := PushResult{
+		BatchesSent:   result.Batches,
+		FailedBatches: result.FailedBatches,
+		SKUsUpdated:   result.Updated,
+		SKUsFailed:    result.Failed,
+		SKUsSkipped:   skippedRows,
+		SKUsDeleted:   deleted,
+		SKUsDryRun:    result.DryRun,
+	}
+	if err := result.authError(); err != nil {
+		return pr, err
+	}
+	return pr, nil
+}
+
+// buildStockPlan читает товары из БД и считает, какой остаток отправить по
+// каждому SKU с учётом OutOfStockPolicy и MaxStockAmount. Второе значение —
+// сколько строк пропущено.
+func buildStockPlan(db *sql.DB, cfg Config, lastStocks map[string]int) ([]stockItem, int, error) {
 	query := `
-        SELECT vendor_code, sku, pcs, available_count
+        SELECT vendor_code, sku, pcs, available_count, COALESCE(source_url, '')
         FROM products
-        WHERE sku IS NOT NULL
+        WHERE sku IS NOT NULL AND active = 1
     `
 	rows, err := db.Query(query)
 	if err != nil {
-		return fmt.Errorf("ошибка при запросе к БД: %v", err)
+		return nil, 0, fmt.Errorf("ошибка при запросе к БД: %v", err)
 	}
 	defer rows.Close()
 
+	if err := validateAvailabilityMultipliers(cfg); err != nil {
+		return nil, 0, err
+	}
+
 	var stocksData []stockItem
+	var emptySKUs, outOfStockSkipped, suppressed int
 
 	for rows.Next() {
 		var (
@@ -173,83 +667,316 @@ func updateStocks(apiKey string, cfg Config) error {
 			vendorCode     string
 			pcs            int
 			availableCount int
+			sourceURL      string
 		)
-		if err := rows.Scan(&vendorCode, &skus, &pcs, &availableCount); err != nil {
+		if err := rows.Scan(&vendorCode, &skus, &pcs, &availableCount, &sourceURL); err != nil {
 			log.Printf("Ошибка чтения строки: %v", err)
 			continue
 		}
+		// Пустой SKU WB не принимает и отклоняет из-за него всю пачку
+		skuList := splitSKUs(skus)
+		if len(skuList) == 0 {
+			log.Printf("Пропускаем %s: пустой SKU", vendorCode)
+			skipped.add(skippedItem{VendorCode: vendorCode, Reason: reasonEmptySKU})
+			emptySKUs++
+			continue
+		}
 
-		amount := calcAmount(pcs, availableCount)
-		item := stockItem{
-			SKU:    skus,
-			Vendor: vendorCode,
-			Amount: amount,
+		// При MultiSKUPolicy = "all" в строке несколько SKU — все получают один остаток
+		baseAmount := stockAmount(cfg, vendorCode, pcs, availableCount)
+		lowAvailability := availableCount > 0 && availableCount < cfg.MinAvailabilityToPush
+		if lowAvailability {
+			debugf("%s: наличие %d меньше MinAvailabilityToPush %d, считаем отсутствующим",
+				vendorCode, availableCount, cfg.MinAvailabilityToPush)
+			suppressed++
+			baseAmount = 0
+		}
+		if limit, ok := cfg.PcsStockCaps[pcs]; ok && baseAmount > limit {
+			log.Printf("Остаток %d для %s (pcs=%d) ограничен PcsStockCaps до %d", baseAmount, vendorCode, pcs, limit)
+			baseAmount = limit
+		}
+		for _, sku := range skuList {
+			amount := baseAmount
+			if amount == 0 {
+				switch cfg.OutOfStockPolicy {
+				case OutOfStockSkip:
+					outOfStockSkipped++
+					continue
+				case OutOfStockKeepLast:
+					if lowAvailability {
+						break
+					}
+					last, ok := lastStocks[sku]
+					if !ok || last == 0 {
+						outOfStockSkipped++
+						continue
+					}
+					amount = last
+				}
+			}
+			if clamped := clampAmount(amount, cfg.MaxStockAmount); clamped != amount {
+				log.Printf("Остаток %d для %s (SKU %s) вне диапазона [0, %d], отправляем %d",
+					amount, vendorCode, sku, cfg.MaxStockAmount, clamped)
+				amount = clamped
+			}
+			item := stockItem{
+				SKU:       sku,
+				Vendor:    vendorCode,
+				Amount:    amount,
+				SourceURL: sourceURL,
+			}
+			stocksData = append(stocksData, item)
 		}
-		stocksData = append(stocksData, item)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Fatalf("Ошибка при чтении строк из БД: %v", err)
+		return nil, 0, fmt.Errorf("ошибка при чтении строк из БД: %v", err)
 	}
+	if emptySKUs > 0 {
+		log.Printf("Пропущено товаров с пустым SKU: %d", emptySKUs)
+	}
+	if suppressed > 0 {
+		log.Printf("Наличие меньше MinAvailabilityToPush %d, считаем отсутствующими: %d", cfg.MinAvailabilityToPush, suppressed)
+	}
+	if outOfStockSkipped > 0 {
+		log.Printf("Не отправляем нет-в-наличии товары по политике %s: %d", cfg.OutOfStockPolicy, outOfStockSkipped)
+	}
+	return stocksData, emptySKUs + outOfStockSkipped, nil
+}
 
-	// Интервал между запросами (для соблюдения 300 в минуту)
-	requestInterval := time.Duration(float64(time.Minute) / float64(RequestLimit))
-
-	// 4) Отправляем запросы по BATCH_SIZE = 1000
-	client := &http.Client{}
-	total := len(stocksData)
-	log.Printf("Всего товаров для отправки: %d\n", total)
-
-	for i := 0; i < total; i += BatchSize {
-		end := i + BatchSize
-		if end > total {
-			end = total
+// splitBatches режет items на пачки по size подряд; последняя может быть короче.
+// Пустой items — ни одной пачки.
+func splitBatches[T any](items []T, size int) [][]T {
+	var batches [][]T
+	for i := 0; i < len(items); i += size {
+		end := i + size
+		if end > len(items) {
+			end = len(items)
 		}
-		batch := stocksData[i:end]
+		batches = append(batches, items[i:end])
+	}
+	return batches
+}
 
-		// Формируем JSON
-		payload := stockRequest{Stocks: batch}
-		jsonBytes, err := json.Marshal(payload)
-		if err != nil {
-			log.Printf("Ошибка маршалинга JSON: %v\n", err)
+// filterSmallDeltas оставляет SKU, остаток которых отличается от последнего
+// отправленного хотя бы на minDelta. Новые SKU и переходы в ноль и из нуля
+// отправляются всегда: "кончился" и "появился" важнее экономии запросов.
+func filterSmallDeltas(items []stockItem, lastStocks map[string]int, minDelta int) ([]stockItem, int) {
+	var kept []stockItem
+	skipped := 0
+	for _, item := range items {
+		last, ok := lastStocks[item.SKU]
+		delta := item.Amount - last
+		if delta < 0 {
+			delta = -delta
+		}
+		if ok && delta < minDelta && (item.Amount == 0) == (last == 0) {
+			skipped++
 			continue
 		}
+		kept = append(kept, item)
+	}
+	return kept, skipped
+}
 
-		// Создаём PUT-запрос
-		url := fmt.Sprintf(WBAPINUrl, WarehouseID)
-		req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(string(jsonBytes)))
-		if err != nil {
-			log.Printf("Ошибка создания запроса: %v\n", err)
+// dedupStockItems убирает повторы SKU из плана, чтобы один и тот же остаток
+// не уходил в WB дважды за прогон (одинаковый баркод у двух строк products,
+// MultiSKUPolicy = "all"). Склад один (WarehouseID), поэтому ключ — SKU.
+// Если остатки у повторов разные, остаётся первый, о конфликте пишется в лог.
+//
+// Заголовка идемпотентности у PUT остатков WB нет, но он и не нужен: PUT
+// задаёт остаток, а не прибавляет, поэтому повтор пачки после таймаута
+// (Retry.Push) не удваивает его, даже если первый запрос дошёл.
+func dedupStockItems(items []stockItem) ([]stockItem, int) {
+	seen := make(map[string]stockItem, len(items))
+	var kept []stockItem
+	dups := 0
+	for _, item := range items {
+		if first, ok := seen[item.SKU]; ok {
+			if first.Amount != item.Amount {
+				log.Printf("⚠️ SKU %s встречается дважды с разным остатком: %d (%s) и %d (%s), отправляем %d",
+					item.SKU, first.Amount, first.Vendor, item.Amount, item.Vendor, first.Amount)
+			}
+			dups++
 			continue
 		}
+		seen[item.SKU] = item
+		kept = append(kept, item)
+	}
+	return kept, dups
+}
 
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+apiKey)
+// deleteInactiveStocks убирает со склада WB остатки выключенных товаров
+// (active = 0), чтобы они не висели с последним отправленным количеством.
+// Возвращает удалённые SKU.
+func deleteInactiveStocks(ctx context.Context, db *sql.DB, client *WBClient) []string {
+	rows, err := db.Query(`SELECT DISTINCT sku FROM products WHERE active = 0 AND sku IS NOT NULL AND TRIM(sku) != ''`)
+	if err != nil {
+		log.Printf("Ошибка при выборке выключенных товаров: %v", err)
+		return nil
+	}
+	var skus []string
+	for rows.Next() {
+		var sku string
+		if err := rows.Scan(&sku); err == nil {
+			skus = append(skus, splitSKUs(sku)...)
+		}
+	}
+	rows.Close()
+	if len(skus) == 0 {
+		return nil
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("❌ Ошибка при отправке запроса: %v\n", err)
-			time.Sleep(requestInterval)
-			continue
+	deleted, err := client.deleteStocks(ctx, skus)
+	for _, sku := range deleted {
+		log.Printf("SKU %s удалён со склада WB (товар выключен)", sku)
+	}
+	if err != nil {
+		log.Printf("❌ %v", err)
+		summary.addError(err)
+	}
+	summary.update(func(s *runSummary) { s.SKUsDeleted += len(deleted) })
+	return deleted
+}
+
+// pushStockBatch отправляет пачку и учитывает результат. Если WB назвал
+// конкретные плохие SKU, они помечаются отклонёнными, а остальная часть
+// пачки отправляется ещё раз без них.
+func pushStockBatch(ctx context.Context, client *WBClient, batch []stockItem, result *pushResult) {
+	err := sendStockBatchRetry(ctx, client, batch)
+
+	var batchErr *stockBatchError
+	if errors.As(err, &batchErr) && len(batchErr.Rejected) > 0 {
+		result.addRejected(batchErr.Rejected)
+		var rest []stockItem
+		for _, item := range batch {
+			if reason, bad := batchErr.Rejected[item.SKU]; bad {
+				deadLetters.add(failedItem{VendorCode: item.Vendor, SKU: item.SKU, Stage: stageRejected, Error: reason})
+				continue
+			}
+			rest = append(rest, item)
+		}
+		log.Printf("⚠️ WB отклонил %d SKU, повторяем пачку без них (%d шт.)\n", len(batch)-len(rest), len(rest))
+		if len(rest) == 0 {
+			return
 		}
+		batch = rest
+		err = sendStockBatchRetry(ctx, client, batch)
+	}
 
-		// Считываем статус
-		if resp.StatusCode == http.StatusNoContent {
-			// 204
-			log.Printf("✅ Успешно обновлены остатки для %d товаров\n", len(batch))
-		} else {
-			// В случае ошибки читаем тело ответа (по желанию), но здесь просто выведем Status
-			b, _ := ioutil.ReadAll(resp.Body)
-			log.Printf("❌ Ошибка при обновлении: статус %d  тело ответа: %s\n", resp.StatusCode, string(b))
+	if err != nil {
+		log.Printf("❌ %v\n", err)
+		result.addFailure(len(batch), err)
+		for _, item := range batch {
+			deadLetters.add(failedItem{VendorCode: item.Vendor, SKU: item.SKU, Stage: stagePush, Error: err.Error()})
 		}
-		resp.Body.Close()
+		return
+	}
+	if client.cfg.DryRun {
+		result.addDryRun(len(batch))
+		return
+	}
+	log.Printf("✅ Успешно обновлены остатки для %d товаров\n", len(batch))
+	result.addSuccess(batch)
+}
 
-		// 6) Пауза, чтобы не превысить лимит
-		time.Sleep(requestInterval)
+// sendStockBatchRetry повторяет отправку пачки, если WB не ответил за PushTimeout.
+// Остальные ошибки возвращаются сразу.
+func sendStockBatchRetry(ctx context.Context, client *WBClient, batch []stockItem) error {
+	return retry(ctx, "отправка пачки остатков", client.cfg.Retry.Push, func(int) error {
+		err := client.sendStockBatch(ctx, batch)
+		if err != nil && !isTimeoutError(err) {
+			return permanent(err)
+		}
+		return err
+	})
+}
+
+// markRejectedSKUs записывает в БД причины, по которым WB отклонил SKU.
+func markRejectedSKUs(db *sql.DB, rejected map[string]string) {
+	for sku, reason := range rejected {
+		log.Printf("SKU %s отклонён WB: %s", sku, reason)
+		// sku может быть списком через запятую (MultiSKUPolicy = "all")
+		if _, err := db.Exec(`UPDATE products SET rejected_reason = ? WHERE sku = ? OR ',' || sku || ',' LIKE '%,' || ? || ',%'`, reason, sku, sku); err != nil {
+			log.Printf("Ошибка при сохранении причины отказа для SKU %s: %v", sku, err)
+		}
 	}
+}
 
-	log.Println("Готово!")
-	return nil
+// pushResult агрегирует итоги отправки пачек из нескольких горутин.
+type pushResult struct {
+	mu            sync.Mutex
+	Batches       int
+	FailedBatches int
+	Updated       int
+	Failed        int
+	Errors        []string
+	Rejected      map[string]string // SKU, которые WB отклонил, с причиной
+	DryRun        int               // SKU, которые в DryRun только записаны в лог
+
+	sent    map[string]int // успешно отправленные остатки sku -> amount
+	authErr error          // первая ошибка авторизации; после неё пачки не отправляются
+}
+
+func (r *pushResult) addSuccess(batch []stockItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Batches++
+	r.Updated += len(batch)
+	if r.sent == nil {
+		r.sent = make(map[string]int)
+	}
+	for _, item := range batch {
+		r.sent[item.SKU] = item.Amount
+	}
+}
+
+// addDryRun учитывает пачку, которая в DryRun не уходила в WB: она не
+// считается ни отправленной, ни обновлённой.
+func (r *pushResult) addDryRun(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.DryRun += n
+}
+
+func (r *pushResult) addFailure(n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Batches++
+	r.FailedBatches++
+	r.Failed += n
+	r.Errors = append(r.Errors, err.Error())
+	if r.authErr == nil && errors.Is(err, ErrWBAuth) {
+		r.authErr = err
+	}
+}
+
+// addRejected учитывает SKU, отклонённые WB поштучно.
+func (r *pushResult) addRejected(rejected map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Rejected == nil {
+		r.Rejected = make(map[string]string)
+	}
+	for sku, reason := range rejected {
+		r.Rejected[sku] = reason
+	}
+	r.Failed += len(rejected)
+	r.Errors = append(r.Errors, fmt.Sprintf("WB отклонил %d SKU", len(rejected)))
+}
+
+// addSkipped учитывает пачку, которую не стали отправлять.
+func (r *pushResult) addSkipped(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Failed += n
+}
+
+// authError возвращает ошибку авторизации, если WB уже отверг токен.
+func (r *pushResult) authError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.authErr
 }
 
 type Config struct {
@@ -258,9 +985,343 @@ type Config struct {
 	DBName             string   // DBName (for example, "ue.db")
 	VendorCodePatterns []string // VendorCodePattern (for example, "^box_\d+_\d+$")
 	UsePcs             bool     // UsePcs (for example, true)
+	BubblebagsCSV      string   // BubblebagsCSV — CSV с адресами страниц bubblebags (по умолчанию "urls.csv")
+	VendorCodeRegexp   string   // VendorCodeRegexp — разбор артикула, группы (?P<productID>) и (?P<pcs>) (по умолчанию DefaultVendorCodeRegexp)
+	PushConcurrency    int      // PushConcurrency — сколько пачек остатков отправлять одновременно (по умолчанию 1)
+	ScrapeWorkers      int      // ScrapeWorkers — сколько вкладок браузера парсят страницы одновременно (по умолчанию 1)
+
+	// PriceHistoryDB — отдельная БД истории цен (по умолчанию "price_history.db").
+	// DBName пересоздаётся каждым прогоном, поэтому история копится не в ней.
+	PriceHistoryDB string
+
+	// PatternsByObjectID — свои VendorCodePatterns для предмета WB (objectID -> шаблоны),
+	// например 3979 -> ["^box_\d+_\d+$"]. Предметы без записи пробуют все VendorCodePatterns.
+	PatternsByObjectID map[int][]string
+
+	// PushTimeout — таймаут одного запроса остатков в WB (по умолчанию 30s).
+	// Запрос, не уложившийся в него, повторяется по Retry.Push.
+	PushTimeout time.Duration
+
+	// BatchDelay — минимальная пауза между выдачей пачек остатков воркерам, поверх
+	// лимитера "stocks". Лимитер копит не больше одного разрешения, поэтому
+	// интервал между пачками — большее из BatchDelay и 60s/RateLimits["stocks"],
+	// а не их сумма. При PushConcurrency > 1 пауза разносит начало отправок,
+	// но не ждёт ответа на предыдущую пачку. 0 — без паузы.
+	BatchDelay time.Duration
+
+	// GzipRequests — сжимать тела запросов остатков в WB (Content-Encoding: gzip).
+	// Включать, только если эндпоинт это принимает.
+	GzipRequests bool
+
+	// Retry — политики повторов парсинга и запросов к WB. Незаданные поля —
+	// прежние значения: 3 попытки с паузой 1s (парсинг, остатки) или 5s (карточки).
+	Retry RetryPolicies
+
+	// Адреса API WB. Пустое значение — продакшен; можно указать песочницу или локальный мок.
+	WBStocksURL    string // шаблон с %d для ID склада (по умолчанию WBAPINUrl)
+	WBCardsListURL string // по умолчанию WBCardsListURL
+	WBPricesURL    string // по умолчанию WBPricesURL
+
+	ScrapeTimeout  time.Duration // ScrapeTimeout — таймаут одной попытки парсинга (по умолчанию 60s)
+	ScrapeAttempts int           // ScrapeAttempts — устаревший аналог Retry.Scrape.MaxAttempts (по умолчанию 3)
+	ScrapeDelay    time.Duration // ScrapeDelay — пауза между парсингом соседних товаров
+	ScrapeJitter   time.Duration // ScrapeJitter — случайная добавка к ScrapeDelay, [0, ScrapeJitter)
+	BlockedPause   time.Duration // BlockedPause — пауза вкладки после заглушки от ботов (ErrScrapeBlocked), 0 — без паузы
+
+	// ReadyTimeout — сколько ждать, пока ключевой элемент страницы (цена или
+	// вкладка) станет видимым, прежде чем считать его отсутствующим
+	// (по умолчанию defaultReadyTimeout). Заменяет фиксированную паузу 2s.
+	ReadyTimeout time.Duration
+
+	// SupplierLogins — вход в кабинеты поставщиков по имени (supplierBubblebags,
+	// supplierCargoAvto), если цены видны только после авторизации. Пусто — без входа.
+	SupplierLogins map[string]SupplierLogin
+
+	// ChromePath — исполняемый файл Chrome/Chromium; пусто — найти в PATH.
+	// ChromeFlags — дополнительные флаги запуска поверх встроенных,
+	// например "--disable-dev-shm-usage" в Docker или "--proxy-server=host:port".
+	// WindowSize — размер окна вида "1280x800"; пусто — по умолчанию Chrome.
+	ChromePath  string
+	ChromeFlags []string
+	WindowSize  string
+
+	// ChromeUserDataDir — профиль браузера (cookies, "принять cookies", пройденные
+	// проверки), который переживает прогоны. Пусто — временный профиль chromedp,
+	// удаляемый после прогона. Один профиль не может открыть два Chrome сразу.
+	ChromeUserDataDir string
+
+	// MinAvailableStores — для cargo-avto товар считается в наличии, только если
+	// он есть хотя бы в стольких магазинах; иначе availableCount = 0 (по умолчанию 1).
+	// Порог отсекает до calcAmount: значения ниже него никогда не попадут в amountTable,
+	// поэтому имеет смысл держать его не выше минимального available_count в таблице.
+	MinAvailableStores int
+
+	// OutOfStockPolicy — что отправлять в WB, если calcAmount вернул 0:
+	// "zero" (по умолчанию) — 0; "skip" — не отправлять SKU;
+	// "keep_last" — последний ненулевой отправленный остаток из StockStatePath.
+	OutOfStockPolicy string
+	AmountTablePath  string      // AmountTablePath — CSV/JSON с правилами available_count,pcs,amount (пусто — встроенная таблица)
+	PcsStockCaps     map[int]int // PcsStockCaps — pcs -> максимальный остаток для WB, независимо от наличия у поставщика
+	MaxStockAmount   int         // MaxStockAmount — верхняя граница остатка для WB (по умолчанию 100000)
+	MinAmountDelta   int         // MinAmountDelta — не отправлять SKU, чей остаток изменился меньше чем на столько с прошлой отправки (0 — отправлять всё)
+	StockStatePath   string      // StockStatePath — файл с последними отправленными остатками (по умолчанию "last_stocks.json")
+
+	// MinPrice — нижняя граница выгружаемой цены: некоторые категории WB не
+	// принимают цены ниже. MinPricePolicy — что делать с ценой ниже неё:
+	// "clamp" (по умолчанию) — поднять до MinPrice; "skip" — не выгружать.
+	MinPrice       int
+	MinPricePolicy string
+
+	// MinAvailabilityToPush — наличие у поставщика (число магазинов), ниже
+	// которого товар считается отсутствующим: уходит в WB с нулём, а при
+	// OutOfStockPolicy = "skip" не отправляется. OutOfStockKeepLast к таким
+	// строкам не применяется — смысл порога в том, чтобы не продавать последний
+	// экземпляр. 0 — без порога.
+	MinAvailabilityToPush int
+
+	// DefaultInStockAmount — остаток для WB у поставщиков, которые сообщают только
+	// "в наличии" без количества (нет селектора Availability, например bubblebags);
+	// DefaultInStockAmountByPcs задаёт его по pcs. Оба пусты — остаток из amountTable
+	// по InStockValue, как раньше.
+	DefaultInStockAmount      int
+	DefaultInStockAmountByPcs map[int]int
+
+	// AvailabilityMultiplier — во сколько раз умножить остаток для WB, посчитанный
+	// по amountTable или DefaultInStockAmount, для поставщика (supplierBubblebags,
+	// supplierCargoAvto); результат округляется.
+	// AvailabilityMultiplierByPattern — то же по регулярке артикула, важнее поставщика.
+	// Так "в наличии" или пара магазинов превращаются в реальный остаток WB без правки
+	// amountTable. Не задано — множитель 1.
+	AvailabilityMultiplier          map[string]float64
+	AvailabilityMultiplierByPattern map[string]float64
+
+	// FallbackToLastKnown — при неудачном парсинге или нулевой цене брать последнюю
+	// ненулевую цену из прошлой БД и помечать строку stale; без неё товар не отправляется.
+	FallbackToLastKnown bool
+
+	// AllowZeroPriceInStock — сохранять нулевую цену у товара в наличии как есть.
+	// По умолчанию такой парсинг повторяется и при неудаче уходит в failed.json.
+	AllowZeroPriceInStock bool
+
+	// SkipZeroPrice — не сохранять в products строки с нулевой ценой, а писать
+	// их в failed.json. Такого товара нет в БД, поэтому остаток в WB по нему не
+	// отправляется и остаётся прежним.
+	SkipZeroPrice bool
+
+	CardsCachePath string        // CardsCachePath — JSON-кеш карточек WB для повторных прогонов (пусто — без кеша)
+	CardsCacheTTL  time.Duration // CardsCacheTTL — срок годности кеша карточек
+	CardsPageSize  int           // CardsPageSize — карточек на страницу getCardsList, 1..1000 (по умолчанию 100)
+
+	// MaxCards — предохранитель: больше карточек не загружать, даже если WB отдаёт
+	// ещё (например, фильтр ObjectIDs задан неверно и захватил весь кабинет).
+	// 0 — без ограничения.
+	MaxCards int
+
+	// ProductIDFile — список productID для точечного перепарсинга. Если задан,
+	// БД не удаляется: обновляются только строки этих товаров, остальные остаются.
+	ProductIDFile string
+
+	// Resume — продолжить прерванный прогон: БД не удаляется, а товары, уже
+	// спарсенные с теми же параметрами не раньше CardsCacheTTL назад, пропускаются.
+	Resume bool
+
+	// AllowEmpty — отправлять остатки, даже если парсинг в этом прогоне
+	// не сохранил ни одного товара (см. checkRunNotEmpty).
+	AllowEmpty bool
+
+	// DryRun — не отправлять и не удалять остатки в WB, только писать в лог,
+	// что ушло бы; уведомления о прогоне тоже не отправляются. Включается -safe.
+	DryRun bool
+
+	// Progress — показывать прогресс парсинга и отправки (-progress): бар в
+	// терминале, строка лога раз в 10 секунд в остальных случаях.
+	Progress bool
+
+	// NotifyWebhook — URL, на который после прогона уходит POST с JSON
+	// {"status": "success"|"failure", "error": ..., "summary": <сводка>}.
+	// TelegramToken и TelegramChatID — бот и чат для короткого сообщения со счётчиками;
+	// прерванный прогон приходит отдельным сообщением с ❌. Пустые — не уведомлять.
+	NotifyWebhook  string
+	TelegramToken  string `json:"-"` // не печатается в -config-dump
+	TelegramChatID string
+
+	// Subjects — названия предметов WB ("Коробки"), которые при старте переводятся
+	// в objectID и добавляются к ObjectIDs. Соответствия кешируются в SubjectsCachePath.
+	Subjects          []string
+	SubjectsCachePath string // SubjectsCachePath — кеш названий предметов (по умолчанию "subjects_cache.json")
+	WBSubjectsURL     string // WBSubjectsURL — справочник предметов WB (по умолчанию WBSubjectsURL)
+
+	// CargoAvtoBaseURL — каталог cargo-avto, к которому дописывается "<productID>/"
+	// (по умолчанию baseURL). Позволяет направить парсер на локальный сервер
+	// с сохранёнными страницами; страницы bubblebags и так берутся из BubblebagsCSV.
+	CargoAvtoBaseURL string
+
+	// RateLimits — лимиты запросов в минуту по эндпоинтам WB ("stocks", "prices", "content").
+	// Незаданные эндпоинты берутся из defaultRateLimits.
+	RateLimits map[string]int
+
+	// Selectors — CSS-селекторы страниц по поставщикам (supplierBubblebags, supplierCargoAvto).
+	// Незаданные поставщики берутся из defaultSelectors.
+	Selectors map[string]SupplierSelectors
+
+	// PriceRounding — округление цены до рублей: "ceil" (по умолчанию), "round" или "floor".
+	// RoundAfterMultiply — сначала умножать цену за штуку на pcs, потом округлять;
+	// по умолчанию наоборот: округлённая цена за штуку умножается на pcs.
+	PriceRounding      string
+	RoundAfterMultiply bool
+
+	// MarkupByObjectID — наценка в процентах к цене поставщика по предмету WB
+	// (objectID -> %), например 3979 (коробки) -> 15. MarkupByPattern — то же по
+	// сработавшему шаблону VendorCodePatterns, важнее objectID. Наценка
+	// применяется к цене за штуку до округления. FP-товары (цена из download.csv)
+	// не затрагиваются. Не задано — без наценки.
+	MarkupByObjectID map[int]float64
+	MarkupByPattern  map[string]float64
+
+	// ExtraColumns — дополнительные колонки products: имя -> тип SQLite (TEXT, INTEGER, REAL).
+	// Заполняются из карточки WB по имени: brand, category, subject_id, supplier;
+	// остальные остаются пустыми и доступны для своих скриптов.
+	ExtraColumns map[string]string
+
+	// WorkDir — каталог для всех создаваемых файлов: БД, кешей, состояния,
+	// сводки и выгрузок. Создаётся при старте. Относительные пути этих файлов
+	// считаются от него, абсолютные не меняются. Входные файлы (urls.csv,
+	// download.csv, таблица остатков) по-прежнему ищутся от текущего каталога.
+	WorkDir string
+
+	// FailedPath — dead-letter файл: товары, которые так и не обработались
+	// (артикул, этап, ошибка). По умолчанию "failed.json"; подходит для -product-id-file.
+	FailedPath string
+
+	// SkippedExportPath — одна выгрузка всех товаров, не дошедших до WB, с колонкой
+	// reason: нет SKU, несколько SKU, нет шаблона, неудачный парсинг и т. д.
+	// ".json" — JSON, иначе CSV. Пусто — не выгружать (-skipped-export).
+	SkippedExportPath string
+
+	// MultiSKUPolicy — что делать с карточкой, у которой несколько SKU (размеров):
+	// "skip" (по умолчанию) — пропустить; "first" — взять первый SKU;
+	// "all" — отправить один и тот же остаток во все SKU карточки.
+	MultiSKUPolicy string
+
+	// MaxScrapeFailureRate — доля неудачных парсингов (0..1), при превышении которой
+	// прогон завершается с ошибкой до отправки остатков. 0 — не проверять.
+	MaxScrapeFailureRate float64
+
+	// SortCards — порядок обработки карточек: "" — как отдал WB, "vendorCode" или "nmID".
+	// С сортировкой логи, порядок записи в БД и выгрузки одинаковы от прогона к прогону.
+	SortCards string
+
+	// ScrapeBackends — чем загружать страницы поставщика: "chrome" (по умолчанию)
+	// или "http" — простой GET без браузера, если цена есть в исходном HTML.
+	ScrapeBackends map[string]string
+
+	// priceRegexps — PriceRegexp поставщиков, скомпилированные в Process
+	// (compilePriceRegexps). Нет записи — DefaultPriceRegexp.
+	priceRegexps map[string]*regexp.Regexp
+}
+
+// inWorkDir переносит относительный путь создаваемого файла в WorkDir.
+func (c *Config) inWorkDir(path string) string {
+	if c.WorkDir == "" || path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.WorkDir, path)
+}
+
+// applyWorkDir создаёт WorkDir и переносит в него выходные файлы конфига.
+// Вызывается один раз после setDefaults.
+func (c *Config) applyWorkDir() error {
+	if c.WorkDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.WorkDir, 0o755); err != nil {
+		return fmt.Errorf("не удалось создать %s: %v", c.WorkDir, err)
+	}
+	for _, p := range []*string{&c.DBName, &c.PriceHistoryDB, &c.StockStatePath, &c.CardsCachePath, &c.SubjectsCachePath, &c.FailedPath, &c.SkippedExportPath, &c.ChromeUserDataDir} {
+		*p = c.inWorkDir(*p)
+	}
+	return nil
 }
 
-const baseURL = "https://sp.cargo-avto.ru/catalog/"
+// setDefaults заполняет незаданные поля значениями по умолчанию.
+func (c *Config) setDefaults() {
+	if c.WBStocksURL == "" {
+		c.WBStocksURL = WBAPINUrl
+	}
+	if c.WBCardsListURL == "" {
+		c.WBCardsListURL = WBCardsListURL
+	}
+	if c.WBPricesURL == "" {
+		c.WBPricesURL = WBPricesURL
+	}
+	if c.CargoAvtoBaseURL == "" {
+		c.CargoAvtoBaseURL = baseURL
+	}
+	if c.WBSubjectsURL == "" {
+		c.WBSubjectsURL = WBSubjectsURL
+	}
+	if c.SubjectsCachePath == "" {
+		c.SubjectsCachePath = "subjects_cache.json"
+	}
+	if c.BubblebagsCSV == "" {
+		c.BubblebagsCSV = "urls.csv"
+	}
+	if c.CardsPageSize == 0 {
+		c.CardsPageSize = defaultCardsPageSize
+	}
+	if c.FailedPath == "" {
+		c.FailedPath = "failed.json"
+	}
+	if c.PushTimeout <= 0 {
+		c.PushTimeout = 30 * time.Second
+	}
+	if c.ReadyTimeout <= 0 {
+		c.ReadyTimeout = defaultReadyTimeout
+	}
+	if c.ScrapeTimeout <= 0 {
+		c.ScrapeTimeout = 60 * time.Second
+	}
+	if c.ScrapeAttempts < 1 {
+		c.ScrapeAttempts = 3
+	}
+	c.Retry.Scrape = c.Retry.Scrape.withDefaults(RetryPolicy{MaxAttempts: c.ScrapeAttempts, BaseDelay: time.Second, MaxDelay: 30 * time.Second})
+	c.Retry.Push = c.Retry.Push.withDefaults(RetryPolicy{MaxAttempts: pushAttempts, BaseDelay: time.Second, MaxDelay: 30 * time.Second})
+	c.Retry.Cards = c.Retry.Cards.withDefaults(RetryPolicy{MaxAttempts: cardsListAttempts, BaseDelay: 5 * time.Second, MaxDelay: time.Minute})
+	if c.MinAvailableStores < 1 {
+		c.MinAvailableStores = 1
+	}
+	if c.VendorCodeRegexp == "" {
+		c.VendorCodeRegexp = DefaultVendorCodeRegexp
+	}
+	if c.RateLimits == nil {
+		c.RateLimits = make(map[string]int)
+	}
+	for endpoint, perMinute := range defaultRateLimits {
+		if c.RateLimits[endpoint] <= 0 {
+			c.RateLimits[endpoint] = perMinute
+		}
+	}
+	if c.Selectors == nil {
+		c.Selectors = make(map[string]SupplierSelectors)
+	}
+	for supplier, sel := range defaultSelectors {
+		if _, ok := c.Selectors[supplier]; !ok {
+			c.Selectors[supplier] = sel
+		}
+	}
+	if c.OutOfStockPolicy == "" {
+		c.OutOfStockPolicy = OutOfStockZero
+	}
+	if c.MaxStockAmount <= 0 {
+		c.MaxStockAmount = 100000
+	}
+	if c.PriceHistoryDB == "" {
+		c.PriceHistoryDB = "price_history.db"
+	}
+	if c.StockStatePath == "" {
+		c.StockStatePath = "last_stocks.json"
+	}
+}
 
 var downloadCSVData = make(map[int]DownloadRow)
 
@@ -269,40 +1330,149 @@ type DownloadRow struct {
 	Quantity int
 }
 
-func Process(apiKey string, cfg Config) error {
+func Process(rootCtx context.Context, apiKey string, cfg Config) (ProcessResult, error) {
+	cfg.setDefaults()
+	var result ProcessResult
+	// Ошибки конфигурации и отсутствие Chrome проверяем до удаления старой БД
+	if cfg.CardsPageSize < 1 || cfg.CardsPageSize > maxCardsPageSize {
+		return result, fmt.Errorf("CardsPageSize=%d вне диапазона 1..%d", cfg.CardsPageSize, maxCardsPageSize)
+	}
+	for supplier := range cfg.ScrapeBackends {
+		if _, err := fetcherFor(cfg, supplier); err != nil {
+			return result, err
+		}
+	}
+	if err := sortCards(nil, cfg.SortCards); err != nil {
+		return result, err
+	}
+	if !validMultiSKUPolicy(cfg.MultiSKUPolicy) {
+		return result, fmt.Errorf("неизвестная MultiSKUPolicy: %q", cfg.MultiSKUPolicy)
+	}
+	if _, err := roundPrice(0, cfg.PriceRounding); err != nil {
+		return result, err
+	}
+	if err := validateMarkups(cfg); err != nil {
+		return result, err
+	}
+	priceRegexps, err := compilePriceRegexps(cfg)
+	if err != nil {
+		return result, err
+	}
+	cfg.priceRegexps = priceRegexps
+
+	// 4. Запускаем Chrome для парсинга страниц
+	ctx, ctxCancel, err := startChrome(rootCtx, cfg)
+	if err != nil {
+		return result, err
+	}
+	defer ctxCancel()
+	if err := loginSuppliers(ctx, cfg); err != nil {
+		return result, err
+	}
 
-	if err := os.Remove(cfg.DBName); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("ошибка удаления старой базы данных: %v", err)
+	runID = newRunID()
+	summary.update(func(s *runSummary) { s.RunID = runID })
+	log.Printf("ID прогона: %s", runID)
+
+	var lastKnownCosts map[string]lastKnown
+	if cfg.FallbackToLastKnown {
+		lastKnownCosts = loadLastKnown(cfg.DBName, cfg.PriceHistoryDB)
+	}
+
+	// Флаг active переживает пересоздание БД
+	inactive := loadInactive(cfg.DBName)
+
+	var onlyProductIDs map[string]bool
+	if cfg.Resume {
+		log.Printf("Продолжаем прерванный прогон: база данных сохраняется")
+	}
+	if cfg.ProductIDFile != "" {
+		ids, err := loadProductIDs(cfg.ProductIDFile)
+		if err != nil {
+			return result, err
+		}
+		onlyProductIDs = ids
+		log.Printf("Точечный парсинг: %d productID из %s, база данных сохраняется", len(ids), cfg.ProductIDFile)
+	} else if !cfg.Resume {
+		if err := os.Remove(cfg.DBName); err != nil && !os.IsNotExist(err) {
+			return result, fmt.Errorf("ошибка удаления старой базы данных: %v", err)
+		}
+		log.Println("Старая база данных удалена.")
 	}
-	log.Println("Старая база данных удалена.")
 
 	db, err := sql.Open("sqlite", cfg.DBName)
 	if err != nil {
-		return fmt.Errorf("ошибка при открытии базы данных: %v", err)
+		return result, fmt.Errorf("ошибка при открытии базы данных: %v", err)
 	}
 	defer db.Close()
 
+	history, err := openPriceHistory(cfg.PriceHistoryDB)
+	if err != nil {
+		return result, err
+	}
+	defer history.Close()
+	priceHistoryDB = history
+	defer func() { priceHistoryDB = nil }()
+
 	createTable(db)
+	if err := migrateExtraColumns(db, cfg.ExtraColumns); err != nil {
+		return result, err
+	}
+
+	client := newWBClient(apiKey, cfg)
+	defer client.Close()
 
 	// 3. Загружаем карточки, используя переданные objectIDs
-	allCards := fetchAllCards(apiKey, cfg.ObjectIDs)
+	allCards, fromCache := []Card(nil), false
+	if cfg.CardsCachePath != "" {
+		allCards, fromCache = loadCachedCards(cfg.CardsCachePath, cfg.CardsCacheTTL)
+	}
+	if fromCache {
+		log.Printf("Карточки загружены из кеша %s", cfg.CardsCachePath)
+	} else {
+		objectIDs := cfg.ObjectIDs
+		if len(cfg.Subjects) > 0 {
+			subjectIDs, err := resolveSubjects(rootCtx, client, cfg.Subjects, cfg.SubjectsCachePath)
+			if err != nil {
+				return result, fmt.Errorf("ошибка определения objectID по названиям предметов: %w", err)
+			}
+			objectIDs = mergeObjectIDs(objectIDs, subjectIDs)
+		}
+		allCards, err = fetchAllCards(rootCtx, client, objectIDs)
+		if err != nil {
+			return result, err
+		}
+		if cfg.CardsCachePath != "" && len(allCards) > 0 {
+			if err := saveCachedCards(cfg.CardsCachePath, allCards); err != nil {
+				log.Printf("Не удалось сохранить кеш карточек: %v", err)
+			}
+		}
+	}
 	log.Printf("Всего загружено %d карточек.", len(allCards))
+	summary.update(func(s *runSummary) { s.CardsFetched = len(allCards) })
+	result.CardsFetched = len(allCards)
 
-	// 4. Настраиваем Chromedp для парсинга страниц
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.Flag("headless", false),
-		chromedp.Flag("disable-gpu", true),
-	)
-	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer allocCancel()
+	vcParser, err := newVendorCodeParser(cfg.VendorCodeRegexp)
+	if err != nil {
+		return result, err
+	}
+	if onlyProductIDs != nil {
+		allCards = filterCardsByProductID(allCards, onlyProductIDs, vcParser)
+		log.Printf("К парсингу отобрано %d карточек.", len(allCards))
+	}
 
-	ctx, ctxCancel := chromedp.NewContext(allocCtx)
-	defer ctxCancel()
+	if err := sortCards(allCards, cfg.SortCards); err != nil {
+		return result, err
+	}
 
-	productDataCache := make(map[string]map[string]string)
 	skuMap := extractSKUs(allCards)
+	backfillSKUs(rootCtx, client, skuMap)
+	stats := newScrapeStats()
 	// vendorCodePattern := regexp.MustCompile(cfg.VendorCodePattern)
-	// 7. Обрабатываем каждую карточку
+	// 7. Разбираем карточки: FP-товары сохраняем сразу, остальные группируем
+	// по productID — у одной страницы может быть несколько карточек с разным pcs
+	var jobs []*scrapeJob
+	jobByProduct := make(map[string]*scrapeJob)
 	for _, card := range allCards {
 		var isFpMatch bool
 		for _, fp := range cfg.FpPatterns {
@@ -319,107 +1489,257 @@ func Process(apiKey string, cfg Config) error {
 			row, exists := downloadCSVData[card.NmID]
 			if !exists {
 				log.Printf("В download.csv нет данных для nm_id=%d", card.NmID)
+				skipped.add(skippedItem{VendorCode: card.VendorCode, NmID: card.NmID, Reason: reasonNoDownloadData})
 				continue
 			}
 
 			pcsInt := 1
-			parts := strings.Split(card.VendorCode, "_")
-			if len(parts) > 2 {
-				if val, err := strconv.Atoi(parts[2]); err == nil {
-					pcsInt = val
-				}
+			if vc, err := vcParser.parse(card.VendorCode); err == nil {
+				pcsInt = vc.Pcs
 			}
 			fmt.Printf("%s pcsInt=%d\n", card.VendorCode, pcsInt)
-			skuList := skuMap[card.NmID]
-			if len(skuList) != 1 {
+			sku, ok := pickSKUs(skuMap[card.NmID], cfg.MultiSKUPolicy)
+			if !ok {
 				log.Printf("FP-товар, но SKUs != 1 для nmID=%d!", card.NmID)
+				skipped.add(skippedItem{VendorCode: card.VendorCode, NmID: card.NmID, Reason: skuReason(skuMap[card.NmID])})
 				continue
 			}
 
 			// Умножаем цену из CSV на количество pcsInt
 			finalCost := row.Price * pcsInt
+			if finalCost == 0 && cfg.SkipZeroPrice {
+				skipZeroPrice(card.VendorCode, fmt.Sprintf("%d", card.NmID), sku)
+				continue
+			}
 
-			saveToDatabase(db, SaveParams{
+			if saveToDatabase(db, SaveParams{
 				NmID:              card.NmID,
 				VendorCode:        card.VendorCode,
 				Pcs:               pcsInt,
 				ProductID:         fmt.Sprintf("%d", card.NmID),
 				AvailableCountStr: strconv.Itoa(row.Quantity),
 				Cost:              finalCost,
-			}, skuList[0])
+				Extra:             cardExtra(card, ""),
+			}, sku) {
+				result.RowsSaved++
+			}
 
 			continue
 		}
 
-		var matched bool
-		for _, pattern := range cfg.VendorCodePatterns {
+		var matchedPattern string
+		for _, pattern := range patternsFor(cfg, card.SubjectID) {
 			if regexp.MustCompile(pattern).MatchString(card.VendorCode) {
-				matched = true
+				matchedPattern = pattern
 				break
 			}
 		}
-		if !matched {
+		if matchedPattern == "" {
 			log.Printf("Пропускаем товар с некорректным VendorCode: %s", card.VendorCode)
+			summary.addUnmatched(card.SubjectID, card.VendorCode)
+			skipped.add(skippedItem{VendorCode: card.VendorCode, NmID: card.NmID, Reason: reasonNoPattern,
+				Detail: fmt.Sprintf("objectID=%d", card.SubjectID)})
 			continue
 		}
 
-		skus := skuMap[card.NmID]
-		if len(skus) != 1 {
-			panic(fmt.Sprintf("SKU либо отсутствует, либо их больше 1 для товара с VendorCode: %s", card.VendorCode))
+		sku, ok := pickSKUs(skuMap[card.NmID], cfg.MultiSKUPolicy)
+		if !ok {
+			log.Printf("Пропускаем %s: SKU либо отсутствует, либо их больше 1 (MultiSKUPolicy=%q)", card.VendorCode, cfg.MultiSKUPolicy)
+			skipped.add(skippedItem{VendorCode: card.VendorCode, NmID: card.NmID, Reason: skuReason(skuMap[card.NmID]),
+				Detail: strings.Join(skuMap[card.NmID], ",")})
+			continue
 		}
 
 		// Извлекаем productID и pcs из vendorCode
-		parts := strings.Split(card.VendorCode, "_")
-		if len(parts) < 2 {
-			log.Printf("Некорректный VendorCode: %s", card.VendorCode)
+		vc, err := vcParser.parse(card.VendorCode)
+		if err != nil {
+			log.Printf("%v", err)
+			skipped.add(skippedItem{VendorCode: card.VendorCode, NmID: card.NmID, SKU: sku, Reason: reasonBadVendorCode, Detail: err.Error()})
 			continue
 		}
-		productID := parts[1]
+		productID := vc.ProductID
 		pcsInt := 1
-		if len(parts) > 2 && cfg.UsePcs {
-			if val, err := strconv.Atoi(parts[2]); err == nil {
-				pcsInt = val
-			}
+		if cfg.UsePcs {
+			pcsInt = vc.Pcs
 		}
 
-		// Парсинг данных товара (с кешированием)
-		var productData map[string]string
-		if cachedData, exists := productDataCache[productID]; exists {
-			log.Printf("Используем кешированные данные для товара: %s", productID)
-			productData = cachedData
-		} else {
-			log.Printf("Парсим страницу для товара: %s", productID)
-			// url := baseURL + productID + "/"
-			// productData, err = scrapeProductData(ctx, url)
-			productData, err = scrapeProductData(ctx, card.VendorCode)
-			if err != nil {
-				log.Printf("Ошибка при обработке товара %s: %v", productID, err)
+		job, ok := jobByProduct[productID]
+		if !ok {
+			job = &scrapeJob{ProductID: productID, VC: vc}
+			jobByProduct[productID] = job
+			jobs = append(jobs, job)
+		}
+		job.Cards = append(job.Cards, cardJob{Card: card, Pattern: matchedPattern, Pcs: pcsInt, SKU: sku})
+	}
+
+	summary.logUnmatched()
+
+	// 8. Парсим страницы в ScrapeWorkers вкладках и сохраняем результаты по мере готовности.
+	// В БД пишет только эта горутина.
+	progress := newRunProgress(db, cfg)
+	if cfg.Resume {
+		before := len(jobs)
+		done := progress.done(cfg.CardsCacheTTL)
+		adopted, err := adoptDone(db, jobs, done)
+		if err != nil {
+			return result, err
+		}
+		jobs = filterDone(jobs, done)
+		log.Printf("Уже спарсено в прерванном прогоне: %d (строк products: %d), осталось: %d", before-len(jobs), adopted, len(jobs))
+	}
+	bar := newProgressBar(cfg.Progress, "Парсинг", len(jobs))
+	for res := range runScrapeWorkers(ctx, cfg, jobs) {
+		saveScrapeResult(db, cfg, stats, lastKnownCosts, res, &result)
+		if res.Err == nil {
+			progress.mark(res.Job.ProductID)
+		}
+		bar.add(1)
+	}
+	bar.finish()
+	restoreInactive(db, inactive)
+	result.Skipped = skippedByReason(skipped, deadLetters)
+	if err := rootCtx.Err(); err != nil {
+		return result, fmt.Errorf("парсинг прерван: %w", err)
+	}
+	progress.clear()
+
+	log.Println("Обработка завершена.")
+	stats.print(os.Stdout)
+	return result, nil
+}
+
+// Значения Config.SortCards.
+const (
+	sortByVendorCode = "vendorCode"
+	sortByNmID       = "nmID"
+)
+
+// sortCards упорядочивает карточки на месте. При равных артикулах порядок
+// решает nmID, так что результат не зависит от порядка ответа WB.
+func sortCards(cards []Card, by string) error {
+	switch by {
+	case "":
+	case sortByVendorCode:
+		sort.Slice(cards, func(i, j int) bool {
+			if cards[i].VendorCode != cards[j].VendorCode {
+				return cards[i].VendorCode < cards[j].VendorCode
+			}
+			return cards[i].NmID < cards[j].NmID
+		})
+	case sortByNmID:
+		sort.Slice(cards, func(i, j int) bool { return cards[i].NmID < cards[j].NmID })
+	default:
+		return fmt.Errorf("неизвестный SortCards: %q (допустимо %q, %q)", by, sortByVendorCode, sortByNmID)
+	}
+	return nil
+}
+
+// saveScrapeResult сохраняет результат парсинга страницы во все карточки товара.
+func saveScrapeResult(db *sql.DB, cfg Config, stats *scrapeStats, lastKnownCosts map[string]lastKnown, res scrapeResult, result *ProcessResult) {
+	job, productData, err := res.Job, res.Data, res.Err
+	if errors.Is(err, ErrPageNotFound) {
+		// Страницы у поставщика нет — товар считаем отсутствующим, без повторов
+		log.Printf("Страница товара %s не найдена, ставим нулевой остаток: %v", job.ProductID, err)
+		productData, err = map[string]string{"price": "0", "availableCount": "0", "notFound": "1"}, nil
+	}
+	if err != nil {
+		log.Printf("Ошибка при обработке товара: %v", err)
+		summary.update(func(s *runSummary) { s.ScrapeFailures++ })
+		summary.addError(err)
+		result.ScrapeFailures++
+		for _, cj := range job.Cards {
+			stats.record(cj.Pattern, outcomeError)
+			if cfg.FallbackToLastKnown && saveLastKnown(db, lastKnownCosts, cj.Card, job.ProductID, cj.Pcs, cj.SKU) {
+				result.RowsSaved++
 				continue
 			}
-			productDataCache[productID] = productData
+			deadLetters.add(failedItem{VendorCode: cj.Card.VendorCode, ProductID: job.ProductID, SKU: cj.SKU, Stage: stageScrape, Error: err.Error()})
 		}
-
-		// Рассчитываем стоимость с учетом количества pcs
-		cost, err := convertAndMultiply(productData["price"], fmt.Sprintf("%d", pcsInt))
+		return
+	}
+	summary.update(func(s *runSummary) { s.ProductsScraped++ })
+	result.PagesScraped++
+
+	for _, cj := range job.Cards {
+		// Рассчитываем стоимость с учетом количества pcs; цена ступени под pcs точнее цены за штуку
+		price := productData["price"]
+		if tierPrice, ok := productData[tierPriceKey(cj.Pcs)]; ok {
+			debugf("vendorCode=%s: цена ступени %d шт.: %s вместо %s", cj.Card.VendorCode, cj.Pcs, tierPrice, price)
+			price = tierPrice
+		}
+		markup := markupFor(cfg, cj.Card.SubjectID, cj.Pattern)
+		cost, err := convertAndMultiply(price, fmt.Sprintf("%d", cj.Pcs), markup, cfg.PriceRounding, cfg.RoundAfterMultiply)
 		if err != nil {
-			log.Printf("Ошибка при конвертации и умножении для %s: %v", productID, err)
+			err = fmt.Errorf("vendorCode=%s: %w", cj.Card.VendorCode, err)
+			log.Printf("Ошибка при конвертации и умножении: %v", err)
+			stats.record(cj.Pattern, outcomeError)
+			summary.addError(err)
+			deadLetters.add(failedItem{VendorCode: cj.Card.VendorCode, ProductID: job.ProductID, SKU: cj.SKU, Stage: stageConvert, Error: err.Error()})
 			continue
 		}
+		if cost == 0 {
+			stats.record(cj.Pattern, outcomeZeroPrice)
+			// Для снятой с продажи страницы старая цена не нужна — это честный ноль
+			if cfg.FallbackToLastKnown && productData["notFound"] == "" {
+				if saveLastKnown(db, lastKnownCosts, cj.Card, job.ProductID, cj.Pcs, cj.SKU) {
+					result.RowsSaved++
+				}
+				continue
+			}
+			if cfg.SkipZeroPrice {
+				skipZeroPrice(cj.Card.VendorCode, job.ProductID, cj.SKU)
+				continue
+			}
+		} else {
+			stats.record(cj.Pattern, outcomeSuccess)
+		}
 
-		saveToDatabase(db, SaveParams{
-			NmID:       card.NmID,
-			VendorCode: card.VendorCode,
+		saved := saveToDatabase(db, SaveParams{
+			NmID:       cj.Card.NmID,
+			VendorCode: cj.Card.VendorCode,
 
-			Pcs:       pcsInt,
-			ProductID: productID,
+			Pcs:       cj.Pcs,
+			ProductID: job.ProductID,
 
 			AvailableCountStr: productData["availableCount"],
 			Cost:              cost,
-		}, skus[0])
+			SourceURL:         productURL(cfg, job.VC),
+			RawPrice:          price,
+			ObjectID:          cj.Card.SubjectID,
+			Extra:             cardExtra(cj.Card, supplierForVendorCode(cj.Card.VendorCode)),
+		}, cj.SKU)
+		if saved {
+			result.RowsSaved++
+		}
 	}
+}
 
-	log.Println("Обработка завершена.")
-	return nil
+// skipZeroPrice вместо строки с нулевой ценой пишет товар в failed.json (SkipZeroPrice).
+func skipZeroPrice(vendorCode, productID, sku string) {
+	log.Printf("vendorCode=%s: нулевая цена, в БД не сохраняем (SkipZeroPrice)", vendorCode)
+	deadLetters.add(failedItem{VendorCode: vendorCode, ProductID: productID, SKU: sku, Stage: stageZeroPrice, Error: "нулевая цена"})
+}
+
+// saveLastKnown сохраняет вместо неудачного парсинга последнюю известную цену
+// с пометкой stale. Если её нет, товар не сохраняется и в WB не уходит.
+func saveLastKnown(db *sql.DB, known map[string]lastKnown, card Card, productID string, pcs int, sku string) bool {
+	lk, ok := known[lastKnownKey(productID, pcs)]
+	if !ok {
+		log.Printf("vendorCode=%s: нет последней известной цены, товар пропущен", card.VendorCode)
+		return false
+	}
+	log.Printf("vendorCode=%s: используем последнюю известную цену %d (stale)", card.VendorCode, lk.Cost)
+	saveToDatabase(db, SaveParams{
+		NmID:              card.NmID,
+		VendorCode:        card.VendorCode,
+		Pcs:               pcs,
+		ProductID:         productID,
+		AvailableCountStr: strconv.Itoa(lk.AvailableCount),
+		Cost:              lk.Cost,
+		Stale:             true,
+		Extra:             cardExtra(card, supplierForVendorCode(card.VendorCode)),
+	}, sku)
+	return true
 }
 
 func createTable(db *sql.DB) {
@@ -433,6 +1753,13 @@ func createTable(db *sql.DB) {
 		sku TEXT,
 		available_count INTEGER,
 		cost INTEGER,
+		stale INTEGER DEFAULT 0,
+		rejected_reason TEXT,
+		active INTEGER DEFAULT 1,
+		run_id TEXT,
+		source_url TEXT,
+		raw_price TEXT,
+		object_id INTEGER,
 		UNIQUE (product_id, pcs)
 	);
 	`
@@ -441,18 +1768,101 @@ func createTable(db *sql.DB) {
 		log.Fatalf("Ошибка при создании таблицы: %v", err)
 	}
 	log.Println("Таблица products проверена/создана.")
+
+	// Прогресс прогона для -resume
+	query = `
+	CREATE TABLE IF NOT EXISTS run_progress (
+		params_key TEXT,
+		product_id TEXT,
+		done_at TEXT,
+		PRIMARY KEY (params_key, product_id)
+	);
+	`
+	if _, err := db.Exec(query); err != nil {
+		log.Fatalf("Ошибка при создании таблицы run_progress: %v", err)
+	}
+
+	if err := validateSchema(db); err != nil {
+		log.Fatalf("Ошибка проверки схемы products: %v", err)
+	}
+
+	// Цель upsert в saveToDatabase (product_id, pcs) уже покрыта индексом
+	// UNIQUE-ограничения; отдельно нужен sku (выборки по SKU в updateStocks
+	// и markRejectedSKUs).
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_products_sku ON products (sku)`,
+	}
+	for _, q := range indexes {
+		if _, err := db.Exec(q); err != nil {
+			log.Fatalf("Ошибка при создании индекса: %v", err)
+		}
+	}
+}
+
+// productsMigrations — колонки, добавленные в products позже первой версии.
+// CREATE TABLE IF NOT EXISTS их в старую БД не добавит.
+var productsMigrations = []struct{ column, ddl string }{
+	{"stale", `ALTER TABLE products ADD COLUMN stale INTEGER DEFAULT 0`},
+	{"rejected_reason", `ALTER TABLE products ADD COLUMN rejected_reason TEXT`},
+	{"active", `ALTER TABLE products ADD COLUMN active INTEGER DEFAULT 1`},
+	{"run_id", `ALTER TABLE products ADD COLUMN run_id TEXT`},
+	{"source_url", `ALTER TABLE products ADD COLUMN source_url TEXT`},
+	{"raw_price", `ALTER TABLE products ADD COLUMN raw_price TEXT`},
+	{"object_id", `ALTER TABLE products ADD COLUMN object_id INTEGER`},
 }
 
-func fetchAllCards(apiKey string, objectIDs []int) []Card {
+// validateSchema проверяет, что БД создана этим инструментом, до того как
+// по ней пойдут запросы: иначе чужой или пустой файл падает посреди прогона
+// с невнятным "no such column". Колонки из productsMigrations, которых нет
+// в БД старой версии, добавляются.
+func validateSchema(db *sql.DB) error {
+	existing, err := tableColumns(db, "products")
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return fmt.Errorf("в БД нет таблицы products: файл пустой или не от cargo_avto (сначала запустите с -scrape)")
+	}
+	var missing []string
+	for col := range coreColumns {
+		if !existing[col] {
+			missing = append(missing, col)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("в таблице products нет колонок %s: БД не от cargo_avto", strings.Join(missing, ", "))
+	}
+	for _, m := range productsMigrations {
+		if existing[m.column] {
+			continue
+		}
+		if _, err := db.Exec(m.ddl); err != nil {
+			return fmt.Errorf("ошибка миграции products (%s): %v", m.column, err)
+		}
+		log.Printf("В products добавлена колонка %s", m.column)
+	}
+	return nil
+}
+
+func fetchAllCards(ctx context.Context, client *WBClient, objectIDs []int) ([]Card, error) {
 	var allCards []Card
 	var updatedAt string
 	var nmID int
 
 	for {
-		response, err := getCardsList(apiKey, updatedAt, nmID, objectIDs)
+		var response *CardsListResponse
+		// Кривой ответ (HTML страницы обслуживания, 5xx) обычно временный — повторяем
+		err := retry(ctx, "запрос страницы карточек", client.cfg.Retry.Cards, func(int) error {
+			var err error
+			response, err = client.getCardsList(ctx, updatedAt, nmID, objectIDs)
+			if errors.Is(err, ErrWBAuth) {
+				return permanent(err)
+			}
+			return err
+		})
 		if err != nil {
-			log.Printf("Ошибка запроса карточек: %v", err)
-			break
+			return nil, fmt.Errorf("загрузка карточек прервана после %d шт.: %w", len(allCards), err)
 		}
 		if response == nil || len(response.Cards) == 0 {
 			log.Println("Больше нет карточек для загрузки.")
@@ -462,12 +1872,40 @@ func fetchAllCards(apiKey string, objectIDs []int) []Card {
 		updatedAt = response.Cursor.UpdatedAt
 		nmID = response.Cursor.NmID
 
-		if updatedAt == "" || nmID == 0 {
+		if limit := client.cfg.MaxCards; limit > 0 && len(allCards) >= limit {
+			if len(allCards) > limit || !lastCardsPage(response, client.cfg.CardsPageSize) {
+				log.Printf("⚠️ Достигнут предел MaxCards=%d, остальные карточки не загружаются. Проверьте ObjectIDs", limit)
+			}
+			allCards = allCards[:limit]
+			break
+		}
+
+		if lastCardsPage(response, client.cfg.CardsPageSize) {
 			break
 		}
 		log.Printf("Загружено %d карточек, продолжаем...", len(allCards))
 	}
-	return allCards
+	return allCards, nil
+}
+
+// lastCardsPage решает, была ли страница последней. WB отдаёт в cursor.total
+// число карточек на этой странице: меньше limit — дальше пусто, и лишний
+// запрос не нужен, даже если курсор заполнен. Полная страница с пустым
+// курсором — продолжать не с чего, тоже конец (с предупреждением: так WB
+// обычно не отвечает).
+func lastCardsPage(response *CardsListResponse, limit int) bool {
+	total := response.Cursor.Total
+	if total == 0 {
+		total = len(response.Cards)
+	}
+	if total < limit {
+		return true
+	}
+	if response.Cursor.UpdatedAt == "" || response.Cursor.NmID == 0 {
+		log.Printf("⚠️ WB вернул полную страницу (%d) без курсора, загрузка карточек может быть неполной", total)
+		return true
+	}
+	return false
 }
 
 type Card struct {
@@ -475,6 +1913,10 @@ type Card struct {
 	VendorCode string        `json:"vendorCode"`
 	UpdatedAt  string        `json:"updatedAt"`
 	Sizes      []ProductSize `json:"sizes"`
+
+	Brand       string `json:"brand"`
+	SubjectID   int    `json:"subjectID"`
+	SubjectName string `json:"subjectName"`
 }
 
 type ProductSize struct {
@@ -502,117 +1944,117 @@ func extractSKUs(cards []Card) map[int][]string {
 	return skuMap
 }
 
-func scrapeProductData(ctx context.Context, vendorCode string) (map[string]string, error) {
-	// Проверяем: ^bubblebags_1\d+_\d+$
-	matched, _ := regexp.MatchString(`^bubblebags_1\d+_\d+$`, vendorCode)
-	if matched {
-		// Пример: "bubblebags_19336_100"
-		// Нам нужно отбросить "_100", чтобы найти "bubblebags_19336" в CSV
-		baseKey := vendorCode
-		if idx := strings.LastIndex(baseKey, "_"); idx != -1 {
-			// baseKey = "bubblebags_19336"
-			baseKey = baseKey[:idx]
+// backfillSKUs дозапрашивает карточки, для которых список вернул пустые sizes,
+// и дописывает найденные SKU в skuMap.
+func backfillSKUs(ctx context.Context, client *WBClient, skuMap map[int][]string) {
+	var missing, backfilled int
+	for nmID, skus := range skuMap {
+		if len(skus) > 0 {
+			continue
+		}
+		missing++
+		card, err := client.getCardByNmID(ctx, nmID)
+		if ctx.Err() != nil {
+			return
 		}
-
-		// Ищем URL в карте, загруженной из CSV
-		csvURL, ok := bubblebagsURLMap[baseKey]
-		if !ok {
-			log.Printf("Не найден URL для %s в urls.csv", vendorCode)
-			return map[string]string{"price": "0", "availableCount": "0"}, nil
-		}
-
-		// Делаем chromedp-скрапинг по csvURL
-		var htmlPrice, htmlStock string
-		err := chromedp.Run(ctx,
-			chromedp.Navigate(csvURL),
-			chromedp.Sleep(2*time.Second),
-			// Ищем наличие товара в <span class="stock">В наличии</span>
-			chromedp.Text(`div.quantity span.stock`, &htmlStock, chromedp.ByQuery),
-			// Ищем цену из кнопки data-count="1"
-			chromedp.Text(`button[data-count="1"] .col_right`, &htmlPrice, chromedp.ByQuery),
-		)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при парсинге страницы %s: %v", csvURL, err)
+			log.Printf("Не удалось дозапросить SKU для nmID=%d: %v", nmID, err)
+			continue
 		}
-
-		// Проверяем наличие
-		var availableCount int
-		if strings.Contains(htmlStock, "В наличии") {
-			availableCount = 5
-		} else {
-			availableCount = 0
+		if card == nil {
+			continue
 		}
-
-		// Извлекаем число из htmlPrice (например, "23 руб.")
-		priceParts := strings.Fields(htmlPrice)
-		if len(priceParts) > 0 {
-			rawPrice := priceParts[0]
-			rawPrice = strings.ReplaceAll(rawPrice, "№", "")
-			rawPrice = strings.TrimSpace(rawPrice)
-			return map[string]string{
-				"price":          rawPrice,
-				"availableCount": fmt.Sprintf("%d", availableCount),
-			}, nil
+		found := extractSKUs([]Card{*card})[nmID]
+		if len(found) > 0 {
+			skuMap[nmID] = found
+			backfilled++
 		}
-
-		return map[string]string{"price": "0", "availableCount": fmt.Sprintf("%d", availableCount)}, nil
 	}
-
-	// Остальной код для "box_\d+_\d+$" и т. д.
-	// (пример парсинга sp.cargo-avto.ru)
-	parts := strings.Split(vendorCode, "_")
-	if len(parts) < 2 {
-		return nil, fmt.Errorf("некорректный VendorCode: %s", vendorCode)
+	if missing > 0 {
+		log.Printf("Карточек без SKU: %d, дозаполнено: %d", missing, backfilled)
 	}
-	url := baseURL + parts[1] + "/"
-
-	var productPrice string
-	var availableStoresCount int
-
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(url),
-		chromedp.Sleep(2*time.Second),
-		chromedp.Click(`li.tabs-item a[href="#samovivoz-tabs"]`, chromedp.ByQuery),
-		chromedp.Sleep(2*time.Second),
-		chromedp.Text(`li[data-min="1"] .price-val`, &productPrice, chromedp.ByQuery),
-		chromedp.Evaluate(`document.querySelectorAll('.avail-item-status.avail').length`, &availableStoresCount),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка парсинга страницы %s: %w", url, err)
-	}
-
-	productPrice = strings.TrimSpace(productPrice)
-	productPrice = strings.ReplaceAll(productPrice, "p", "")
-	productPrice = strings.ReplaceAll(productPrice, " ", "")
-
-	return map[string]string{
-		"price":          productPrice,
-		"availableCount": fmt.Sprintf("%d", availableStoresCount),
-	}, nil
 }
 
-func convertAndMultiply(priceStr, multiplierStr string) (int, error) {
+// convertAndMultiply считает стоимость карточки: цена за штуку с наценкой
+// markupPct (в процентах), умноженная на pcs и округлённая по rounding.
+func convertAndMultiply(priceStr, multiplierStr string, markupPct float64, rounding string, roundAfterMultiply bool) (int, error) {
 	price, err := strconv.ParseFloat(priceStr, 64)
 	if err != nil {
 		return 0, fmt.Errorf("ошибка преобразования price: %v", err)
 	}
-	roundedPrice := int(math.Ceil(price))
+	price *= 1 + markupPct/100
 
 	multiplier, err := strconv.Atoi(multiplierStr)
 	if err != nil {
 		return 0, fmt.Errorf("ошибка преобразования multiplier: %v", err)
 	}
+	if roundAfterMultiply {
+		return roundPrice(price*float64(multiplier), rounding)
+	}
+	roundedPrice, err := roundPrice(price, rounding)
+	if err != nil {
+		return 0, err
+	}
 	return roundedPrice * multiplier, nil
 }
 
-func getCardsList(apiKey string, updatedAt string, nmID int, objectIDs []int) (*CardsListResponse, error) {
-	url := "https://content-api.wildberries.ru/content/v2/get/cards/list"
-	client := &http.Client{Timeout: 10 * time.Second}
+// markupFor — наценка в процентах для карточки: по шаблону артикула, затем по objectID.
+func markupFor(cfg Config, objectID int, pattern string) float64 {
+	if m, ok := cfg.MarkupByPattern[pattern]; ok {
+		return m
+	}
+	return cfg.MarkupByObjectID[objectID]
+}
+
+// validateMarkups не даёт наценке обнулить или сделать отрицательной цену.
+func validateMarkups(cfg Config) error {
+	for objectID, m := range cfg.MarkupByObjectID {
+		if m <= -100 {
+			return fmt.Errorf("MarkupByObjectID[%d] = %v%%: цена станет нулевой или отрицательной", objectID, m)
+		}
+	}
+	for pattern, m := range cfg.MarkupByPattern {
+		if m <= -100 {
+			return fmt.Errorf("MarkupByPattern[%q] = %v%%: цена станет нулевой или отрицательной", pattern, m)
+		}
+	}
+	return nil
+}
+
+// Значения Config.MinPricePolicy.
+const (
+	MinPriceClamp = "clamp"
+	MinPriceSkip  = "skip"
+)
 
+// Способы округления цены (Config.PriceRounding).
+const (
+	RoundCeil  = "ceil"
+	RoundRound = "round"
+	RoundFloor = "floor"
+)
+
+// roundPrice округляет цену до рублей. Перед округлением убирается погрешность
+// float64, иначе 0.1*3 = 0.30000000000000004 и ceil дал бы лишний рубль.
+func roundPrice(v float64, mode string) (int, error) {
+	v = math.Round(v*1e6) / 1e6
+	switch mode {
+	case "", RoundCeil:
+		return int(math.Ceil(v)), nil
+	case RoundRound:
+		return int(math.Round(v)), nil
+	case RoundFloor:
+		return int(math.Floor(v)), nil
+	default:
+		return 0, fmt.Errorf("неизвестный PriceRounding: %q", mode)
+	}
+}
+
+func (c *WBClient) getCardsList(ctx context.Context, updatedAt string, nmID int, objectIDs []int) (*CardsListResponse, error) {
 	bodyData := map[string]interface{}{
 		"settings": map[string]interface{}{
 			"cursor": map[string]interface{}{
-				"limit": 100,
+				"limit": c.cfg.CardsPageSize,
 			},
 			"filter": map[string]interface{}{
 				"withPhoto": 1,
@@ -628,32 +2070,83 @@ func getCardsList(apiKey string, updatedAt string, nmID int, objectIDs []int) (*
 		bodyData["settings"].(map[string]interface{})["cursor"].(map[string]interface{})["nmID"] = nmID
 	}
 
+	return c.postCardsList(ctx, bodyData)
+}
+
+// getCardByNmID ищет одну карточку по nmID через текстовый поиск cards/list.
+// Возвращает nil, если WB такую карточку не нашёл.
+func (c *WBClient) getCardByNmID(ctx context.Context, nmID int) (*Card, error) {
+	bodyData := map[string]interface{}{
+		"settings": map[string]interface{}{
+			"cursor": map[string]interface{}{
+				"limit": 10,
+			},
+			"filter": map[string]interface{}{
+				"textSearch": strconv.Itoa(nmID),
+				"withPhoto":  -1,
+			},
+		},
+	}
+
+	response, err := c.postCardsList(ctx, bodyData)
+	if err != nil {
+		return nil, err
+	}
+	for i := range response.Cards {
+		if response.Cards[i].NmID == nmID {
+			return &response.Cards[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *WBClient) postCardsList(ctx context.Context, bodyData map[string]interface{}) (*CardsListResponse, error) {
 	bodyJSON, err := json.Marshal(bodyData)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewReader(bodyJSON))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.WBCardsListURL, bytes.NewReader(bodyJSON))
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", apiKey)
+	req.Header.Set("Authorization", c.apiKey)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(req)
+	if err := c.wait(ctx, wbEndpointContent); err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	// Тело дочитывается и при ошибке разбора: иначе соединение не вернётся в пул
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
 
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	if err := checkAuthStatus(resp); err != nil {
 		return nil, err
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%w: статус %d, ответ: %s", ErrWBBadResponse, resp.StatusCode, bodySnippet(b))
+	}
+	// Страница на 1000 карточек — мегабайты JSON: разбираем потоком, не читая
+	// в память целиком. Начало ответа запоминаем для текста ошибки.
+	br := bufio.NewReaderSize(resp.Body, 4096)
+	head, _ := br.Peek(512)
+	head = append([]byte(nil), head...)
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.Contains(ct, "json") {
+		return nil, fmt.Errorf("%w: Content-Type %q, ответ: %s", ErrWBBadResponse, ct, bodySnippet(head))
+	}
+
 	var response CardsListResponse
-	if err := json.Unmarshal(b, &response); err != nil {
-		return nil, err
+	if err := json.NewDecoder(br).Decode(&response); err != nil {
+		// Обрыв на середине (unexpected EOF) — тоже временная ошибка: fetchAllCards повторит запрос
+		return nil, fmt.Errorf("%w: ошибка разбора: %v, начало ответа: %s", ErrWBBadResponse, err, bodySnippet(head))
 	}
 	return &response, nil
 }
@@ -667,22 +2160,36 @@ type SaveParams struct {
 
 	AvailableCountStr string
 	Cost              int
+	Stale             bool   // цена взята из прошлого прогона, а не спарсена сейчас
+	SourceURL         string // страница поставщика, с которой взята цена (пусто для FP-товаров)
+
+	// RawPrice — цена за штуку со страницы поставщика до наценки и округления,
+	// ObjectID — предмет карточки. По ним recompute пересчитывает cost без парсинга.
+	// Пустой RawPrice (FP-товары, stale) — строку recompute не трогает.
+	RawPrice string
+	ObjectID int
+
+	// Extra — значения для Config.ExtraColumns (brand, category, subject_id, supplier).
+	// Пишутся только колонки, заданные в конфиге.
+	Extra map[string]interface{}
 }
 
-func saveToDatabase(db *sql.DB, params SaveParams, sku string) {
+// saveToDatabase пишет строку products; false — строку сохранить не удалось.
+func saveToDatabase(db *sql.DB, params SaveParams, sku string) bool {
 	availableCount, err := strconv.Atoi(params.AvailableCountStr)
 	if err != nil {
-		log.Printf("Ошибка при конвертации availableCount для %s: %v", params.ProductID, err)
+		log.Printf("Ошибка при конвертации availableCount: vendorCode=%s: %v", params.VendorCode, err)
 		availableCount = 0
 	}
 
-	fmt.Printf("saveToDatabase: nmID: %d, vendorCode: %s, pcs: %d, productID: %s, sku: %s, availableCount: %d, cost: %d\n",
-		params.NmID, params.VendorCode, params.Pcs, params.ProductID, sku, availableCount, params.Cost)
+	fmt.Printf("saveToDatabase: nmID: %d, vendorCode: %s, pcs: %d, productID: %s, sku: %s, availableCount: %d, cost: %d, url: %s\n",
+		params.NmID, params.VendorCode, params.Pcs, params.ProductID, sku, availableCount, params.Cost, params.SourceURL)
 
 	query := `
 			INSERT INTO products (
-			nm_id, vendor_code,	pcs, product_id,sku, available_count, cost)
-			VALUES (?, ?, ?, ?, ?, ?, ?)
+			nm_id, vendor_code,	pcs, product_id,sku, available_count, cost, stale, run_id, source_url,
+			raw_price, object_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 			ON CONFLICT(product_id, pcs) DO UPDATE SET
 			nm_id = excluded.nm_id,
 			vendor_code = excluded.vendor_code,
@@ -690,49 +2197,61 @@ func saveToDatabase(db *sql.DB, params SaveParams, sku string) {
 			product_id = excluded.product_id,
 			sku = excluded.sku,
 			available_count = excluded.available_count,
-			cost = excluded.cost;
+			cost = excluded.cost,
+			stale = excluded.stale,
+			run_id = excluded.run_id,
+			source_url = excluded.source_url,
+			raw_price = excluded.raw_price,
+			object_id = excluded.object_id;
 		`
 
 	_, err = db.Exec(query,
 		params.NmID, params.VendorCode,
 		params.Pcs, params.ProductID, sku,
-		availableCount, params.Cost,
+		availableCount, params.Cost, params.Stale, runID, params.SourceURL,
+		params.RawPrice, params.ObjectID,
 	)
 	if err != nil {
-		log.Printf("Ошибка при сохранении данных для %s: %v", params.ProductID, err)
-	} else {
-		log.Printf("Данные для товара %s успешно сохранены. SKUs: %s", params.ProductID, sku)
+		log.Printf("Ошибка при сохранении данных: vendorCode=%s: %v", params.VendorCode, err)
+		return false
+	}
+	log.Printf("Данные для товара %s успешно сохранены. SKUs: %s", params.ProductID, sku)
+
+	if err := saveExtraColumns(db, params); err != nil {
+		log.Printf("Ошибка при сохранении дополнительных колонок: vendorCode=%s: %v", params.VendorCode, err)
+	}
+
+	if err := appendPriceHistory(priceHistoryDB, params.ProductID, params.Pcs, params.Cost, availableCount); err != nil {
+		log.Printf("Ошибка при записи истории цен: vendorCode=%s: %v", params.VendorCode, err)
 	}
+	return true
 }
 
+// clampAmount ограничивает остаток диапазоном [0, max].
+func clampAmount(amount, max int) int {
+	if amount < 0 {
+		return 0
+	}
+	if amount > max {
+		return max
+	}
+	return amount
+}
+
+// calcAmount переводит наличие у поставщика в остаток для WB по amountTable.
+// Любое сочетание, которого нет в таблице, в том числе отрицательные pcs или
+// availableCount, даёт 0 — такой товар уходит в WB как отсутствующий.
+// Для bubblebags availableCount — это InStockValue поставщика, поэтому при его
+// изменении нужно поправить и строки таблицы.
 func calcAmount(pcs, availableCount int) int {
-	if availableCount == 5 && pcs == 100 {
-		return 1
-	} else if availableCount == 5 && pcs == 50 {
-		return 1
-	} else if availableCount == 5 && pcs == 30 {
-		return 2
-	} else if availableCount == 5 && pcs == 10 {
-		return 5
-	} else if availableCount == 4 && pcs == 30 {
-		return 1
-	} else if availableCount == 4 && pcs == 10 {
-		return 3
-	} else if availableCount == 5 && pcs == 1 {
-		return 5
-	} else if availableCount == 5 && pcs == 3 {
-		return 3
-	} else if availableCount == 5 && pcs == 5 {
-		return 2
-	}
-
-	return 0
+	return amountTable[amountKey{AvailableCount: availableCount, Pcs: pcs}]
 }
 
 type stockItem struct {
-	SKU    string `json:"sku"`
-	Vendor string `json:"vendor"`
-	Amount int    `json:"amount"`
+	SKU       string `json:"sku"`
+	Vendor    string `json:"vendor"`
+	Amount    int    `json:"amount"`
+	SourceURL string `json:"-"` // только для выгрузки плана, в WB не уходит
 }
 
 // Структура для JSON, который отправляется в WB API
@@ -872,6 +2391,14 @@ func updateXLSXPrices(cfg Config, filePath string) error {
 		return fmt.Errorf("ошибка при открытии базы данных: %v", err)
 	}
 	defer db.Close()
+	if err := validateSchema(db); err != nil {
+		return fmt.Errorf("%s: %w", cfg.DBName, err)
+	}
+	switch cfg.MinPricePolicy {
+	case "", MinPriceClamp, MinPriceSkip:
+	default:
+		return fmt.Errorf("неизвестная MinPricePolicy: %q", cfg.MinPricePolicy)
+	}
 
 	f, err := excelize.OpenFile(filePath)
 	if err != nil {
@@ -908,6 +2435,15 @@ func updateXLSXPrices(cfg Config, filePath string) error {
 			continue
 		}
 
+		if cost < cfg.MinPrice {
+			if cfg.MinPricePolicy == MinPriceSkip {
+				log.Printf("⚠️ nmID=%d: цена %d ниже MinPrice %d, не выгружаем — проверьте парсинг", nmID, cost, cfg.MinPrice)
+				continue
+			}
+			log.Printf("⚠️ nmID=%d: цена %d ниже MinPrice %d, выгружаем %d — проверьте парсинг", nmID, cost, cfg.MinPrice, cfg.MinPrice)
+			cost = cfg.MinPrice
+		}
+
 		log.Printf("Обновляем Excel: nmID=%d, newCost=%d, строка %d (столбец B)", nmID, cost, i)
 		cellB := fmt.Sprintf("B%d", i)
 		f.SetCellValue(sheetName, cellB, float64(cost))
@@ -0,0 +1,47 @@
+package main
+
+import "strings"
+
+// Значения Config.MultiSKUPolicy.
+const (
+	MultiSKUSkip  = "skip"
+	MultiSKUFirst = "first"
+	MultiSKUAll   = "all"
+)
+
+func validMultiSKUPolicy(p string) bool {
+	switch p {
+	case "", MultiSKUSkip, MultiSKUFirst, MultiSKUAll:
+		return true
+	}
+	return false
+}
+
+// pickSKUs выбирает по политике, какие SKU карточки хранить в products.sku.
+// При "all" это список через запятую; buildStockPlan разворачивает его через splitSKUs.
+// false — карточку нужно пропустить.
+func pickSKUs(skus []string, policy string) (string, bool) {
+	switch {
+	case len(skus) == 0:
+		return "", false
+	case len(skus) == 1:
+		return skus[0], true
+	case policy == MultiSKUFirst:
+		return skus[0], true
+	case policy == MultiSKUAll:
+		return strings.Join(skus, ","), true
+	default:
+		return "", false
+	}
+}
+
+// splitSKUs разбирает значение products.sku: один SKU или список через запятую.
+func splitSKUs(s string) []string {
+	var skus []string
+	for _, sku := range strings.Split(s, ",") {
+		if sku = strings.TrimSpace(sku); sku != "" {
+			skus = append(skus, sku)
+		}
+	}
+	return skus
+}
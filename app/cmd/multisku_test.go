@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractSKUs(t *testing.T) {
+	tests := []struct {
+		name string
+		card Card
+		want []string
+	}{
+		{"без размеров", Card{NmID: 1}, nil},
+		{"размер без SKU", Card{NmID: 1, Sizes: []ProductSize{{}}}, nil},
+		{"один SKU", Card{NmID: 1, Sizes: []ProductSize{{SKUs: []string{"2000000000011"}}}}, []string{"2000000000011"}},
+		{"несколько размеров", Card{NmID: 1, Sizes: []ProductSize{
+			{SKUs: []string{"2000000000011"}},
+			{SKUs: []string{"2000000000028"}},
+		}}, []string{"2000000000011", "2000000000028"}},
+		{"несколько SKU в размере", Card{NmID: 1, Sizes: []ProductSize{
+			{SKUs: []string{"2000000000011", "2000000000028"}},
+			{},
+			{SKUs: []string{"2000000000035"}},
+		}}, []string{"2000000000011", "2000000000028", "2000000000035"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractSKUs([]Card{tt.card})
+			skus, ok := got[tt.card.NmID]
+			if !ok {
+				t.Fatalf("нет записи для nmID=%d: %v", tt.card.NmID, got)
+			}
+			if !reflect.DeepEqual(skus, tt.want) {
+				t.Errorf("extractSKUs = %q, want %q", skus, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractSKUsSeveralCards(t *testing.T) {
+	got := extractSKUs([]Card{
+		{NmID: 1, Sizes: []ProductSize{{SKUs: []string{"a"}}}},
+		{NmID: 2},
+		{NmID: 3, Sizes: []ProductSize{{SKUs: []string{"b"}}, {SKUs: []string{"c"}}}},
+	})
+	want := map[int][]string{1: {"a"}, 2: nil, 3: {"b", "c"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extractSKUs = %v, want %v", got, want)
+	}
+}
+
+func TestPickSKUs(t *testing.T) {
+	multi := []string{"a", "b", "c"}
+	tests := []struct {
+		name   string
+		skus   []string
+		policy string
+		want   string
+		wantOK bool
+	}{
+		{"нет SKU", nil, "", "", false},
+		{"нет SKU, all", nil, MultiSKUAll, "", false},
+		{"пустой список, first", []string{}, MultiSKUFirst, "", false},
+		{"один SKU", []string{"a"}, "", "a", true},
+		{"один SKU, skip", []string{"a"}, MultiSKUSkip, "a", true},
+		{"несколько, по умолчанию пропуск", multi, "", "", false},
+		{"несколько, skip", multi, MultiSKUSkip, "", false},
+		{"несколько, first", multi, MultiSKUFirst, "a", true},
+		{"несколько, all", multi, MultiSKUAll, "a,b,c", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := pickSKUs(tt.skus, tt.policy)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("pickSKUs(%q, %q) = %q, %v; want %q, %v", tt.skus, tt.policy, got, ok, tt.want, tt.wantOK)
+			}
+			if ok && tt.policy == MultiSKUAll && !reflect.DeepEqual(splitSKUs(got), tt.skus) {
+				t.Errorf("splitSKUs(%q) = %q, want %q", got, splitSKUs(got), tt.skus)
+			}
+		})
+	}
+}
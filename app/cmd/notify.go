@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// notifyTimeout — сколько ждать вебхук и Telegram. Уведомление отправляется
+// уже после прогона, поэтому ctx прогона (возможно, отменённый) не используется.
+const notifyTimeout = 15 * time.Second
+
+// telegramAPIURL — адрес Bot API, к нему дописывается "<token>/sendMessage".
+var telegramAPIURL = "https://api.telegram.org/bot"
+
+var notifyHTTPClient = &http.Client{Timeout: notifyTimeout}
+
+// runNotification — тело POST на NotifyWebhook.
+type runNotification struct {
+	Status  string          `json:"status"` // "success" или "failure"
+	Error   string          `json:"error,omitempty"`
+	Summary json.RawMessage `json:"summary"`
+}
+
+// notifyRun сообщает об окончании прогона в NotifyWebhook и/или Telegram.
+// runErr != nil — прогон прерван: уходит отдельное сообщение об ошибке.
+// Ошибки отправки только логируются: уведомление не должно ронять прогон.
+// В DryRun (и -safe) уведомления не отправляются: у такого прогона не должно
+// быть последствий снаружи.
+func notifyRun(cfg Config, runErr error) {
+	if cfg.NotifyWebhook == "" && (cfg.TelegramToken == "" || cfg.TelegramChatID == "") {
+		return
+	}
+	if cfg.DryRun {
+		log.Printf("[dry-run] Уведомление об окончании прогона не отправляется")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	b, err := summary.finish()
+	if err != nil {
+		log.Printf("Уведомление не отправлено: %v", err)
+		return
+	}
+	if cfg.NotifyWebhook != "" {
+		if err := postWebhook(ctx, cfg.NotifyWebhook, runErr, b); err != nil {
+			log.Printf("Не удалось отправить вебхук: %v", err)
+		}
+	}
+	if cfg.TelegramToken != "" && cfg.TelegramChatID != "" {
+		if err := sendTelegram(ctx, cfg.TelegramToken, cfg.TelegramChatID, runMessage(runErr)); err != nil {
+			log.Printf("Не удалось отправить сообщение в Telegram: %v", err)
+		}
+	}
+}
+
+func postWebhook(ctx context.Context, hookURL string, runErr error, summaryJSON []byte) error {
+	n := runNotification{Status: "success", Summary: summaryJSON}
+	if runErr != nil {
+		n.Status, n.Error = "failure", runErr.Error()
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга уведомления: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doNotify(req)
+}
+
+// runMessage — короткий текст для Telegram с основными счётчиками сводки.
+func runMessage(runErr error) string {
+	summary.mu.Lock()
+	defer summary.mu.Unlock()
+
+	head := "✅ cargo_avto: прогон завершён"
+	if runErr != nil {
+		head = fmt.Sprintf("❌ cargo_avto: прогон прерван\n%v", runErr)
+	} else if len(summary.Errors) > 0 {
+		head = fmt.Sprintf("⚠️ cargo_avto: прогон завершён с ошибками (%d)", len(summary.Errors))
+	}
+	return fmt.Sprintf("%s\nКарточек: %d\nСпарсено: %d, ошибок парсинга: %d\nОстатков обновлено: %d, не отправлено: %d, пропущено: %d\nДлительность: %s",
+		head, summary.CardsFetched, summary.ProductsScraped, summary.ScrapeFailures,
+		summary.SKUsUpdated, summary.SKUsFailed, summary.SKUsSkipped,
+		summary.FinishedAt.Sub(summary.StartedAt).Round(time.Second))
+}
+
+func sendTelegram(ctx context.Context, token, chatID, text string) error {
+	form := url.Values{"chat_id": {chatID}, "text": {text}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, telegramAPIURL+token+"/sendMessage",
+		bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		// В ошибке URL с токеном — не выводим его
+		return fmt.Errorf("ошибка создания запроса")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doNotify(req)
+}
+
+func doNotify(req *http.Request) error {
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		if uErr, ok := err.(*url.Error); ok {
+			// url.Error содержит полный адрес, а в нём может быть токен бота
+			err = uErr.Err
+		}
+		return fmt.Errorf("ошибка запроса: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("статус %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
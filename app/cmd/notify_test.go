@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNotifyRunDryRun(t *testing.T) {
+	var hooks, telegram int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hook" {
+			atomic.AddInt32(&hooks, 1)
+		} else {
+			atomic.AddInt32(&telegram, 1)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	prev := telegramAPIURL
+	telegramAPIURL = srv.URL + "/bot"
+	t.Cleanup(func() { telegramAPIURL = prev })
+
+	cfg := Config{NotifyWebhook: srv.URL + "/hook", TelegramToken: "token", TelegramChatID: "1"}
+
+	cfg.DryRun = true
+	notifyRun(cfg, nil)
+	if h, tg := atomic.LoadInt32(&hooks), atomic.LoadInt32(&telegram); h != 0 || tg != 0 {
+		t.Errorf("в DryRun отправлено: вебхук %d, Telegram %d", h, tg)
+	}
+
+	cfg.DryRun = false
+	notifyRun(cfg, nil)
+	if h, tg := atomic.LoadInt32(&hooks), atomic.LoadInt32(&telegram); h != 1 || tg != 1 {
+		t.Errorf("без DryRun отправлено: вебхук %d, Telegram %d, want по 1", h, tg)
+	}
+}
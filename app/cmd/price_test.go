@@ -0,0 +1,172 @@
+package main
+
+import "testing"
+
+// Тексты цен в том виде, в каком их отдают селекторы Price и TierPrice.
+func TestCleanPrice(t *testing.T) {
+	tests := []struct {
+		name, raw, decimalSep, want string
+	}{
+		{"bubblebags: копейки через запятую", "23,40 руб.", "", "23.40"},
+		{"bubblebags: целая цена", "41 руб.", "", "41"},
+		{"bubblebags: сокращение р.", "23р.", "", "23"},
+		{"cargo-avto: разряды пробелом и ₽", "1 234,50 ₽", "", "1234.50"},
+		{"cargo-avto: неразрывные пробелы", "1\u00a0234\u00a0руб.", "", "1234"},
+		{"узкий неразрывный пробел", "12\u202f990\u00a0₽", "", "12990"},
+		{"перевод строки вокруг цены", "\n\t  990 ₽\n", "", "990"},
+		{"латинская p вместо р", "12.50 p", "", "12.50"},
+		{"разряды запятой, дробь точкой", "1,234.50", "", "1234.50"},
+		{"разряды точкой, дробь запятой", "1.234,50 руб", "", "1234.50"},
+		{"знак номера", "№ 15", "", "15"},
+		{"висящая точка", "2 190.", "", "2190"},
+		{"только валюта", "руб.", "", ""},
+		{"пусто", "", "", ""},
+		{"DecimalSeparator=.: запятая — разряды", "1,234", ".", "1234"},
+		{"DecimalSeparator=,: точка — разряды", "1.234,5", ",", "1234.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanPrice(tt.raw, tt.decimalSep); got != tt.want {
+				t.Errorf("cleanPrice(%q, %q) = %q, want %q", tt.raw, tt.decimalSep, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractPrice(t *testing.T) {
+	tests := []struct {
+		name, raw, expr, want string
+	}{
+		{"от N руб.", "от 23 руб.", "", "23"},
+		{"N руб.", "23 руб.", "", "23"},
+		{"разряды и ₽", "1 234 ₽", "", "1234"},
+		{"разряды неразрывным пробелом", "1\u00a0234\u00a0₽", "", "1234"},
+		{"копейки", "от 23,40 руб.", "", "23.40"},
+		{"берётся первое число", "23 руб. (от 100 шт. — 21 руб.)", "", "23"},
+		{"нет числа", "Цена по запросу", "", ""},
+		{"пусто", "", "", ""},
+		{"группа price", "от 10 шт. за 19 руб.", `за (?P<price>\d+)`, "19"},
+		{"без группы — всё совпадение", "арт. 5512, цена 340 руб.", `\d+ руб`, "340"},
+		{"шаблон не совпал", "23 руб.", `за (?P<price>\d+)`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Selectors: map[string]SupplierSelectors{supplierCargoAvto: {PriceRegexp: tt.expr}}}
+			res, err := compilePriceRegexps(cfg)
+			if err != nil {
+				t.Fatalf("compilePriceRegexps(%q): %v", tt.expr, err)
+			}
+			if got := extractPrice(tt.raw, res[supplierCargoAvto], ""); got != tt.want {
+				t.Errorf("extractPrice(%q, %q) = %q, want %q", tt.raw, tt.expr, got, tt.want)
+			}
+		})
+	}
+
+	// nil — DefaultPriceRegexp, как у поставщика без PriceRegexp
+	if got := extractPrice("от 23 руб.", nil, ""); got != "23" {
+		t.Errorf("extractPrice без регулярки = %q, want 23", got)
+	}
+}
+
+func TestCompilePriceRegexpsInvalid(t *testing.T) {
+	cfg := Config{Selectors: map[string]SupplierSelectors{supplierCargoAvto: {PriceRegexp: `(\d+`}}}
+	if _, err := compilePriceRegexps(cfg); err == nil {
+		t.Error("некорректный PriceRegexp должен давать ошибку при проверке конфига")
+	}
+}
+
+func TestNormalizeDecimal(t *testing.T) {
+	tests := []struct {
+		s, decimalSep, want string
+	}{
+		// Эвристика без DecimalSeparator
+		{"1234", "", "1234"},
+		{"12,5", "", "12.5"},
+		{"12.5", "", "12.5"},
+		{"1,234", "", "1.234"}, // одиночная запятая — десятичная, как в рублёвых ценах
+		{"1.234", "", "1.234"}, // одиночная точка — десятичная
+		{"1,234,567", "", "1234567"},
+		{"1.234.567", "", "1234567"},
+		{"1,234.50", "", "1234.50"},
+		{"1.234,50", "", "1234.50"},
+		{"1.234.567,89", "", "1234567.89"},
+		{"1,234,567.89", "", "1234567.89"},
+
+		// Явный разделитель снимает неоднозначность
+		{"1,234", ".", "1234"},
+		{"1.234", ",", "1234"},
+		{"1,234", ",", "1.234"},
+		{"1.234", ".", "1.234"},
+		{"1,234.50", ".", "1234.50"},
+		{"1.234,50", ",", "1234.50"},
+	}
+	for _, tt := range tests {
+		if got := normalizeDecimal(tt.s, tt.decimalSep); got != tt.want {
+			t.Errorf("normalizeDecimal(%q, %q) = %q, want %q", tt.s, tt.decimalSep, got, tt.want)
+		}
+	}
+}
+
+func TestConvertAndMultiplyFractional(t *testing.T) {
+	tests := []struct {
+		name               string
+		price, pcs         string
+		markup             float64
+		rounding           string
+		roundAfterMultiply bool
+		want               int
+	}{
+		// По умолчанию: цена за штуку вверх до рубля, потом × pcs
+		{"по умолчанию ceil до умножения", "23.40", "10", 0, "", false, 240},
+		{"ceil до умножения", "23.40", "10", 0, RoundCeil, false, 240},
+		{"round до умножения", "23.40", "10", 0, RoundRound, false, 230},
+		{"floor до умножения", "23.40", "10", 0, RoundFloor, false, 230},
+		{"ceil после умножения", "23.40", "10", 0, RoundCeil, true, 234},
+		{"round после умножения", "23.40", "10", 0, RoundRound, true, 234},
+		{"floor после умножения", "23.40", "10", 0, RoundFloor, true, 234},
+
+		// Половина копейки в сумме
+		{"ceil 12.5 × 3 до", "12.5", "3", 0, RoundCeil, false, 39},
+		{"ceil 12.5 × 3 после", "12.5", "3", 0, RoundCeil, true, 38},
+		{"round 12.5 × 3 до", "12.5", "3", 0, RoundRound, false, 39},
+		{"round 12.5 × 3 после", "12.5", "3", 0, RoundRound, true, 38},
+		{"floor 12.5 × 3 до", "12.5", "3", 0, RoundFloor, false, 36},
+		{"floor 12.5 × 3 после", "12.5", "3", 0, RoundFloor, true, 37},
+
+		// Погрешность float не должна давать лишний рубль: 0.7 × 10 = 7.000000000000001
+		{"погрешность произведения", "0.7", "10", 0, RoundCeil, true, 7},
+		{"погрешность наценки", "100", "1", 15, RoundCeil, false, 115},
+		{"наценка с копейками", "23.40", "10", 10, RoundCeil, false, 260},
+		{"наценка после умножения", "23.40", "10", 10, RoundCeil, true, 258},
+
+		{"целая цена", "41", "100", 0, "", false, 4100},
+		{"нулевая цена", "0", "10", 0, "", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertAndMultiply(tt.price, tt.pcs, tt.markup, tt.rounding, tt.roundAfterMultiply)
+			if err != nil {
+				t.Fatalf("convertAndMultiply: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("convertAndMultiply(%s, %s, %v, %q, %v) = %d, want %d",
+					tt.price, tt.pcs, tt.markup, tt.rounding, tt.roundAfterMultiply, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertAndMultiplyErrors(t *testing.T) {
+	tests := []struct {
+		name, price, pcs, rounding string
+	}{
+		{"цена не число", "23,40", "10", ""},
+		{"pcs не число", "23.40", "10шт", ""},
+		{"неизвестное округление", "23.40", "10", "up"},
+	}
+	for _, tt := range tests {
+		if _, err := convertAndMultiply(tt.price, tt.pcs, 0, tt.rounding, false); err == nil {
+			t.Errorf("%s: ошибки нет", tt.name)
+		}
+	}
+}
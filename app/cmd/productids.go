@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadProductIDs читает список productID для точечного перепарсинга:
+// по одному на строку, пустые строки и строки с # пропускаются.
+// Dead-letter файл (failed.json) тоже подходит: из него берутся product_id.
+func loadProductIDs(path string) (map[string]bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия %s: %v", path, err)
+	}
+
+	ids := make(map[string]bool)
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		var items []failedItem
+		if err := json.Unmarshal(b, &items); err != nil {
+			return nil, fmt.Errorf("ошибка разбора %s: %v", path, err)
+		}
+		for _, item := range items {
+			if item.ProductID != "" {
+				ids[item.ProductID] = true
+			}
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			ids[line] = true
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("ошибка чтения %s: %v", path, err)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("в %s нет ни одного productID", path)
+	}
+	return ids, nil
+}
+
+// filterCardsByProductID оставляет карточки, чей productID есть в ids.
+// У FP-товаров productID — это nmID, поэтому он тоже проверяется.
+func filterCardsByProductID(cards []Card, ids map[string]bool, parser *vendorCodeParser) []Card {
+	var filtered []Card
+	found := make(map[string]bool)
+	for _, card := range cards {
+		nmID := strconv.Itoa(card.NmID)
+		if ids[nmID] {
+			filtered = append(filtered, card)
+			found[nmID] = true
+			continue
+		}
+		vc, err := parser.parse(card.VendorCode)
+		if err != nil || !ids[vc.ProductID] {
+			continue
+		}
+		filtered = append(filtered, card)
+		found[vc.ProductID] = true
+	}
+	for id := range ids {
+		if !found[id] {
+			log.Printf("productID %s не найден среди карточек WB", id)
+		}
+	}
+	return filtered
+}
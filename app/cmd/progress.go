@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// runProgress — какие товары уже спарсены прогоном с такими же параметрами.
+// Строки пишутся всегда, а читаются только с -resume: если прогон упал
+// на середине, перезапуск пропустит уже сохранённые товары.
+type runProgress struct {
+	db  *sql.DB
+	key string
+}
+
+// progressKey отличает прогоны с разными наборами карточек и шаблонов,
+// чтобы -resume не пропустил товары, которые другой конфиг не парсил.
+func progressKey(cfg Config) string {
+	b, _ := json.Marshal(struct {
+		ObjectIDs          []int
+		Subjects           []string
+		FpPatterns         []string
+		VendorCodePatterns []string
+		PatternsByObjectID map[int][]string
+		UsePcs             bool
+		ProductIDFile      string
+	}{cfg.ObjectIDs, cfg.Subjects, cfg.FpPatterns, cfg.VendorCodePatterns, cfg.PatternsByObjectID, cfg.UsePcs, cfg.ProductIDFile})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+func newRunProgress(db *sql.DB, cfg Config) *runProgress {
+	return &runProgress{db: db, key: progressKey(cfg)}
+}
+
+// done возвращает productID, спарсенные не раньше ttl назад.
+func (p *runProgress) done(ttl time.Duration) map[string]bool {
+	done := make(map[string]bool)
+	since := time.Now().Add(-ttl).UTC().Format(time.RFC3339)
+	rows, err := p.db.Query(`SELECT product_id FROM run_progress WHERE params_key = ? AND done_at >= ?`, p.key, since)
+	if err != nil {
+		log.Printf("Ошибка чтения run_progress: %v", err)
+		return done
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var productID string
+		if err := rows.Scan(&productID); err == nil {
+			done[productID] = true
+		}
+	}
+	return done
+}
+
+func (p *runProgress) mark(productID string) {
+	_, err := p.db.Exec(`
+		INSERT INTO run_progress (params_key, product_id, done_at) VALUES (?, ?, ?)
+		ON CONFLICT(params_key, product_id) DO UPDATE SET done_at = excluded.done_at`,
+		p.key, productID, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Ошибка записи run_progress для %s: %v", productID, err)
+	}
+}
+
+// clear забывает прогресс после полностью завершённого прогона.
+func (p *runProgress) clear() {
+	if _, err := p.db.Exec(`DELETE FROM run_progress WHERE params_key = ?`, p.key); err != nil {
+		log.Printf("Ошибка очистки run_progress: %v", err)
+	}
+}
+
+// adoptDone переносит строки товаров, спарсенных прерванным прогоном, в
+// текущий прогон (run_id): с -resume они не парсятся заново, но для
+// checkRunNotEmpty и выгрузок остаются его частью. Возвращает число строк.
+func adoptDone(db *sql.DB, jobs []*scrapeJob, done map[string]bool) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	var adopted int64
+	for _, job := range jobs {
+		if !done[job.ProductID] {
+			continue
+		}
+		res, err := tx.Exec(`UPDATE products SET run_id = ? WHERE product_id = ?`, runID, job.ProductID)
+		if err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("ошибка обновления run_id для %s: %v", job.ProductID, err)
+		}
+		n, _ := res.RowsAffected()
+		adopted += n
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка фиксации транзакции: %v", err)
+	}
+	return int(adopted), nil
+}
+
+// filterDone убирает из заданий товары, уже спарсенные прошлым прогоном.
+func filterDone(jobs []*scrapeJob, done map[string]bool) []*scrapeJob {
+	var rest []*scrapeJob
+	for _, job := range jobs {
+		if !done[job.ProductID] {
+			rest = append(rest, job)
+		}
+	}
+	return rest
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestResumeAllDoneNotEmpty: -resume, когда прерванный прогон успел спарсить
+// всё, — новых строк нет, но перенесённые считаются, и остатки отправляются.
+func TestResumeAllDoneNotEmpty(t *testing.T) {
+	prev := runID
+	t.Cleanup(func() { runID = prev })
+
+	db, path := newTestDB(t)
+	insertProducts(t, db,
+		testProduct{VendorCode: "box_1_10", ProductID: "1", SKU: "a", Pcs: 10, AvailableCount: 5},
+		testProduct{VendorCode: "box_1_30", ProductID: "1", SKU: "b", Pcs: 30, AvailableCount: 5},
+		testProduct{VendorCode: "box_2_10", ProductID: "2", SKU: "c", Pcs: 10, AvailableCount: 5},
+	)
+	if _, err := db.Exec(`UPDATE products SET run_id = 'interrupted'`); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(t, path)
+	runID = "resumed"
+
+	if err := checkRunNotEmpty(db, cfg); !errors.Is(err, ErrEmptyRun) {
+		t.Fatalf("до переноса: ошибка %v, want ErrEmptyRun", err)
+	}
+
+	jobs := []*scrapeJob{{ProductID: "1"}, {ProductID: "2"}}
+	done := map[string]bool{"1": true, "2": true}
+	adopted, err := adoptDone(db, jobs, done)
+	if err != nil {
+		t.Fatalf("adoptDone: %v", err)
+	}
+	if adopted != 3 {
+		t.Errorf("перенесено строк %d, want 3", adopted)
+	}
+	if rest := filterDone(jobs, done); len(rest) != 0 {
+		t.Errorf("осталось заданий %d, want 0", len(rest))
+	}
+	if err := checkRunNotEmpty(db, cfg); err != nil {
+		t.Errorf("после переноса: %v", err)
+	}
+}
+
+func TestAdoptDoneOnlyDoneJobs(t *testing.T) {
+	prev := runID
+	t.Cleanup(func() { runID = prev })
+
+	db, _ := newTestDB(t)
+	insertProducts(t, db,
+		testProduct{VendorCode: "box_1_10", ProductID: "1", SKU: "a", Pcs: 10},
+		testProduct{VendorCode: "box_2_10", ProductID: "2", SKU: "b", Pcs: 10},
+		testProduct{VendorCode: "box_3_10", ProductID: "3", SKU: "c", Pcs: 10},
+	)
+	if _, err := db.Exec(`UPDATE products SET run_id = 'interrupted'`); err != nil {
+		t.Fatal(err)
+	}
+	runID = "resumed"
+
+	// 2 не спарсен прерванным прогоном, 3 не входит в текущие задания
+	jobs := []*scrapeJob{{ProductID: "1"}, {ProductID: "2"}}
+	if _, err := adoptDone(db, jobs, map[string]bool{"1": true, "3": true}); err != nil {
+		t.Fatalf("adoptDone: %v", err)
+	}
+	want := map[string]string{"1": "resumed", "2": "interrupted", "3": "interrupted"}
+	for id, wantRun := range want {
+		var got string
+		if err := db.QueryRow(`SELECT run_id FROM products WHERE product_id = ?`, id).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != wantRun {
+			t.Errorf("product %s: run_id %q, want %q", id, got, wantRun)
+		}
+	}
+}
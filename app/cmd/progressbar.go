@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressLogInterval — как часто писать прогресс строкой лога, если вывод не в терминал.
+const progressLogInterval = 10 * time.Second
+
+const progressBarWidth = 30
+
+// progressBar показывает done/total шага (-progress). В терминале — строка
+// с \r, которая перерисовывается на месте; иначе (cron, файл) — строка лога
+// раз в progressLogInterval. nil-бар ничего не делает, так что вызывающему
+// коду не нужно проверять, включён ли прогресс.
+type progressBar struct {
+	mu      sync.Mutex
+	label   string
+	total   int
+	done    int
+	out     io.Writer
+	tty     bool
+	lastLog time.Time
+}
+
+// newProgressBar возвращает nil, если прогресс выключен.
+func newProgressBar(enabled bool, label string, total int) *progressBar {
+	if !enabled || total <= 0 {
+		return nil
+	}
+	return &progressBar{label: label, total: total, out: os.Stderr, tty: isTerminal(os.Stderr), lastLog: time.Now()}
+}
+
+// isTerminal — вывод идёт в терминал, а не в файл или пайп.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// add отмечает ещё n выполненных единиц; безопасен из нескольких горутин.
+func (p *progressBar) add(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	if p.tty {
+		p.draw()
+		return
+	}
+	if time.Since(p.lastLog) >= progressLogInterval {
+		p.lastLog = time.Now()
+		log.Printf("%s: %d/%d", p.label, p.done, p.total)
+	}
+}
+
+// finish дорисовывает бар и переводит строку.
+func (p *progressBar) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		p.draw()
+		fmt.Fprintln(p.out)
+		return
+	}
+	log.Printf("%s: %d/%d", p.label, p.done, p.total)
+}
+
+func (p *progressBar) draw() {
+	filled := p.done * progressBarWidth / p.total
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	fmt.Fprintf(p.out, "\r%s [%s%s] %d/%d", p.label,
+		strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled), p.done, p.total)
+}
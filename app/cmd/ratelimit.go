@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// rateLimiter раздаёт разрешения на запросы не чаще perMinute в минуту.
+// Один лимитер делится между всеми горутинами, которые ходят в один и тот же
+// эндпоинт WB, поэтому параллельная отправка не превышает общий лимит.
+type rateLimiter struct {
+	ticker *time.Ticker
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	interval := time.Duration(float64(time.Minute) / float64(perMinute))
+	return &rateLimiter{ticker: time.NewTicker(interval)}
+}
+
+// Wait блокируется до следующего свободного слота или отмены контекста.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-l.ticker.C:
+		return nil
+	}
+}
+
+func (l *rateLimiter) Stop() {
+	l.ticker.Stop()
+}
+
+// sleepCtx ждёт d или отмены контекста — что наступит раньше.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// jittered возвращает base плюс случайную добавку из [0, jitter).
+func jittered(base, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return base
+	}
+	return base + time.Duration(rand.Int63n(int64(jitter)))
+}
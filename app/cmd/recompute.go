@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+)
+
+// runRecompute пересчитывает cost в products из сохранённых raw_price и pcs по
+// текущим наценкам и округлению — без Chrome и без нового парсинга. Остатки
+// считаются из available_count при каждой отправке, поэтому после правки
+// amountTable достаточно -push. С -push остатки, с -push-price — цены уходят
+// в WB, как при обычном прогоне.
+func runRecompute(ctx context.Context, cfg Config, apiKey string, args []string) error {
+	fs := flag.NewFlagSet("recompute", flag.ExitOnError)
+	push := fs.Bool("push", false, "после пересчёта отправить остатки в WB")
+	pushPrice := fs.Bool("push-price", false, "после пересчёта обновить цены (export_product_cost_data.xlsx)")
+	fs.Parse(args)
+
+	if err := validateMarkups(cfg); err != nil {
+		return err
+	}
+	if _, err := roundPrice(0, cfg.PriceRounding); err != nil {
+		return err
+	}
+	if err := recomputeCosts(cfg); err != nil {
+		return err
+	}
+
+	if *push {
+		if apiKey == "" {
+			return fmt.Errorf("для -push нужна переменная окружения WB_API_KEY")
+		}
+		result, err := updateStocks(ctx, apiKey, cfg)
+		log.Printf("Итог отправки остатков: %s", result)
+		if err != nil {
+			return fmt.Errorf("ошибка при обновлении стоки: %w", err)
+		}
+	}
+	if *pushPrice {
+		if err := updateXLSXPrices(cfg, "export_product_cost_data.xlsx"); err != nil {
+			return fmt.Errorf("ошибка при обновлении цен: %w", err)
+		}
+	}
+	return nil
+}
+
+// recomputeCosts обновляет cost строк с raw_price. Строки без raw_price
+// (FP-товары, stale, БД до появления колонки) остаются как есть.
+func recomputeCosts(cfg Config) error {
+	db, err := sql.Open("sqlite", cfg.DBName)
+	if err != nil {
+		return fmt.Errorf("ошибка при открытии базы данных: %v", err)
+	}
+	defer db.Close()
+	if err := validateSchema(db); err != nil {
+		return fmt.Errorf("%s: %w", cfg.DBName, err)
+	}
+
+	rows, err := db.Query(`
+        SELECT id, vendor_code, pcs, raw_price, COALESCE(object_id, 0), cost
+        FROM products
+        WHERE COALESCE(raw_price, '') != ''
+    `)
+	if err != nil {
+		return fmt.Errorf("ошибка при запросе к БД: %v", err)
+	}
+	type update struct {
+		id   int
+		cost int
+	}
+	var updates []update
+	var total, skipped int
+	for rows.Next() {
+		var (
+			id, pcs, objectID, cost int
+			vendorCode, rawPrice    string
+		)
+		if err := rows.Scan(&id, &vendorCode, &pcs, &rawPrice, &objectID, &cost); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка чтения строки: %v", err)
+		}
+		total++
+		markup := markupFor(cfg, objectID, matchedPattern(cfg, objectID, vendorCode))
+		newCost, err := convertAndMultiply(rawPrice, strconv.Itoa(pcs), markup, cfg.PriceRounding, cfg.RoundAfterMultiply)
+		if err != nil {
+			log.Printf("vendorCode=%s: не удалось пересчитать цену %q: %v", vendorCode, rawPrice, err)
+			skipped++
+			continue
+		}
+		if newCost != cost {
+			debugf("vendorCode=%s: cost %d -> %d", vendorCode, cost, newCost)
+			updates = append(updates, update{id, newCost})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при чтении строк из БД: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %v", err)
+	}
+	for _, u := range updates {
+		if _, err := tx.Exec(`UPDATE products SET cost = ? WHERE id = ?`, u.cost, u.id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("ошибка обновления cost: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка фиксации транзакции: %v", err)
+	}
+	log.Printf("Пересчёт цен: строк с сохранённой ценой %d, изменено %d, с ошибкой %d", total, len(updates), skipped)
+	return nil
+}
+
+// matchedPattern — первый подходящий шаблон VendorCodePatterns, как в Process; "" — ни один.
+func matchedPattern(cfg Config, objectID int, vendorCode string) string {
+	for _, pattern := range patternsFor(cfg, objectID) {
+		if re, err := regexp.Compile(pattern); err == nil && re.MatchString(vendorCode) {
+			return pattern
+		}
+	}
+	return ""
+}
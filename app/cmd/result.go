@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProcessResult — итог Process: что загружено, спарсено и сохранено в БД.
+// При ошибке содержит то, что успели сделать до неё.
+type ProcessResult struct {
+	CardsFetched   int
+	PagesScraped   int // страниц поставщиков, спарсенных успешно (в т. ч. снятых с продажи)
+	ScrapeFailures int
+	RowsSaved      int            // строк products, записанных в БД
+	Skipped        map[string]int // причина (reason* и этапы deadLetters) -> сколько товаров
+}
+
+func (r ProcessResult) String() string {
+	return fmt.Sprintf("карточек %d, страниц спарсено %d, с ошибкой %d, сохранено строк %d, пропущено: %s",
+		r.CardsFetched, r.PagesScraped, r.ScrapeFailures, r.RowsSaved, formatReasons(r.Skipped))
+}
+
+// PushResult — итог updateStocks.
+type PushResult struct {
+	BatchesSent   int
+	FailedBatches int
+	SKUsUpdated   int
+	SKUsFailed    int
+	SKUsSkipped   int // не отправлены по правилам: пустой SKU, OutOfStockPolicy, MinAmountDelta
+	SKUsDeleted   int // остатки выключенных товаров, удалённые в WB
+	SKUsDryRun    int // в DryRun не отправлены, только записаны в лог
+}
+
+func (r PushResult) String() string {
+	s := fmt.Sprintf("пачек %d (с ошибкой %d), SKU обновлено %d, не обновлено %d, пропущено %d, удалено %d",
+		r.BatchesSent, r.FailedBatches, r.SKUsUpdated, r.SKUsFailed, r.SKUsSkipped, r.SKUsDeleted)
+	if r.SKUsDryRun > 0 {
+		s += fmt.Sprintf(", dry-run (не отправлено) %d", r.SKUsDryRun)
+	}
+	return s
+}
+
+// skippedByReason считает пропущенные товары и неудачи deadLetters по причинам.
+func skippedByReason(s *skippedLog, dead *deadLetterLog) map[string]int {
+	counts := make(map[string]int)
+	s.mu.Lock()
+	for _, it := range s.items {
+		counts[it.Reason]++
+	}
+	s.mu.Unlock()
+	dead.mu.Lock()
+	for _, f := range dead.items {
+		counts[f.Stage]++
+	}
+	dead.mu.Unlock()
+	return counts
+}
+
+// formatReasons печатает счётчики причин по алфавиту: "no_sku=2, scrape=1".
+func formatReasons(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "нет"
+	}
+	reasons := make([]string, 0, len(counts))
+	for r := range counts {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	parts := make([]string, len(reasons))
+	for i, r := range reasons {
+		parts[i] = fmt.Sprintf("%s=%d", r, counts[r])
+	}
+	return strings.Join(parts, ", ")
+}
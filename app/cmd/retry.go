@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy — сколько раз и с какими паузами повторять операцию.
+// Пауза перед попыткой n+1 — BaseDelay·2^(n-1), не больше MaxDelay (0 — без предела).
+// С Jitter пауза случайно уменьшается до половины, чтобы воркеры не повторяли хором.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      bool
+}
+
+// RetryPolicies — повторы по операциям (Config.Retry). Незаданные поля
+// заполняет setDefaults значениями, с которыми инструмент работал раньше.
+type RetryPolicies struct {
+	Scrape RetryPolicy // парсинг страницы поставщика при временной ошибке
+	Push   RetryPolicy // отправка пачки остатков, если WB не ответил за PushTimeout
+	Cards  RetryPolicy // запрос страницы карточек при кривом ответе WB
+}
+
+// withDefaults дополняет незаданные поля политики значениями def.
+func (p RetryPolicy) withDefaults(def RetryPolicy) RetryPolicy {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = def.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = def.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = def.MaxDelay
+	}
+	return p
+}
+
+// delay — пауза после неудачной попытки attempt (с 1).
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter && d > 1 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+	return d
+}
+
+// permanentError — ошибка, которую retry не повторяет.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// permanent помечает ошибку fn как окончательную: повтор не поможет.
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// retry вызывает fn до успеха, окончательной ошибки (permanent), отмены ctx
+// или исчерпания попыток. Каждая неудачная попытка пишется в debug-лог,
+// успех после повторов — в обычный (logRecovered). Ошибка возвращается без
+// обёртки permanent и с числом попыток (retryError).
+func retry(ctx context.Context, op string, p RetryPolicy, fn func(attempt int) error) error {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	attempt := 1
+	for ; ; attempt++ {
+		err := fn(attempt)
+		if err == nil {
+			logRecovered(op, attempt)
+			return nil
+		}
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return retryError(attempt, perm.err)
+		}
+		if ctx.Err() != nil || attempt >= p.MaxAttempts {
+			return retryError(attempt, err)
+		}
+		debugf("%s: попытка %d/%d не удалась: %v", op, attempt, p.MaxAttempts, err)
+		if err := sleepCtx(ctx, p.delay(attempt)); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// runID — идентификатор текущего прогона Process. Пишется в products.run_id
+// каждой сохранённой строки и в сводку, чтобы потом ответить, что сделал прогон X.
+var runID string
+
+// newRunID возвращает сортируемый по времени ID вида 20240131T150405Z-1a2b3c4d.
+func newRunID() string {
+	id := time.Now().UTC().Format("20060102T150405Z")
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err == nil {
+		id += "-" + hex.EncodeToString(b)
+	}
+	return id
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// applySafeMode включает -safe: прогон без последствий снаружи и для рабочих данных.
+//   - остатки в WB не отправляются и не удаляются (DryRun), last_stocks.json не меняется;
+//   - вебхук и Telegram не получают уведомление об окончании прогона;
+//   - парсинг пишет в копии БД и истории цен safe_<имя>, рабочие не удаляются и не меняются;
+//   - подробный лог.
+//
+// Вызывается после applyWorkDir, чтобы копия лежала рядом с рабочей БД.
+func applySafeMode(cfg *Config) error {
+	cfg.DryRun = true
+	debugLogging = true
+
+	scratch := filepath.Join(filepath.Dir(cfg.DBName), "safe_"+filepath.Base(cfg.DBName))
+	// Копия нужна, чтобы прошлые цены и выключенные товары читались как обычно
+	if err := copyFile(cfg.DBName, scratch); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("не удалось скопировать БД для -safe: %v", err)
+	}
+	log.Printf("Безопасный режим: остатки в WB не отправляются, БД — копия %s", scratch)
+	cfg.DBName = scratch
+
+	// История цен тоже пишется в копию, чтобы -safe не дописывал её
+	historyScratch := filepath.Join(filepath.Dir(cfg.PriceHistoryDB), "safe_"+filepath.Base(cfg.PriceHistoryDB))
+	if err := copyFile(cfg.PriceHistoryDB, historyScratch); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("не удалось скопировать историю цен для -safe: %v", err)
+	}
+	cfg.PriceHistoryDB = historyScratch
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
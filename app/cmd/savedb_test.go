@@ -0,0 +1,79 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const benchRows = 10000
+
+// benchSaveRows пишет benchRows строк products через saveToDatabase.
+func benchSaveRows(b *testing.B, db *sql.DB, cost int) {
+	for i := 0; i < benchRows; i++ {
+		ok := saveToDatabase(db, SaveParams{
+			NmID:              100000 + i,
+			VendorCode:        "box_" + strconv.Itoa(i) + "_10",
+			Pcs:               10,
+			ProductID:         strconv.Itoa(i),
+			AvailableCountStr: "5",
+			Cost:              cost,
+			RawPrice:          "12.50",
+		}, strconv.Itoa(2000000000000+i))
+		if !ok {
+			b.Fatalf("строка %d не сохранена", i)
+		}
+	}
+}
+
+// BenchmarkSaveToDatabase — upsert 10k строк products вместе с историей цен:
+// insert — в пустую БД, update — поверх тех же (product_id, pcs).
+func BenchmarkSaveToDatabase(b *testing.B) {
+	// saveToDatabase печатает каждую строку в stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	b.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+
+	openHistory := func(b *testing.B) {
+		history, err := openPriceHistory(filepath.Join(b.TempDir(), "price_history.db"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		priceHistoryDB = history
+		b.Cleanup(func() {
+			priceHistoryDB = nil
+			history.Close()
+		})
+	}
+
+	b.Run("insert", func(b *testing.B) {
+		openHistory(b)
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			db, _ := newTestDB(b)
+			b.StartTimer()
+			benchSaveRows(b, db, 125)
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*benchRows), "ns/row")
+	})
+
+	b.Run("update", func(b *testing.B) {
+		openHistory(b)
+		db, _ := newTestDB(b)
+		benchSaveRows(b, db, 125)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			benchSaveRows(b, db, 126+n)
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*benchRows), "ns/row")
+	})
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/chromedp/chromedp"
+)
+
+const baseURL = "https://sp.cargo-avto.ru/catalog/"
+
+// Поставщики, у которых парсятся страницы товаров.
+const (
+	supplierBubblebags = "bubblebags"
+	supplierCargoAvto  = "cargo-avto"
+)
+
+// SupplierSelectors — CSS-селекторы страницы товара поставщика.
+// Пустой селектор означает, что у поставщика такого элемента нет.
+type SupplierSelectors struct {
+	Price        string // цена за штуку
+	Stock        string // текст наличия ("В наличии")
+	Tab          string // вкладка, по которой нужно кликнуть перед чтением цены
+	Availability string // элементы магазинов, где товар есть; считается их количество
+
+	// AvailabilityPanel — контейнер списка магазинов, который есть на любой
+	// странице товара (и без магазинов): Availability считается только после
+	// его появления, иначе ждём до ScrapeTimeout. Пусто — не ждать. AvailabilityRecheck — через
+	// сколько пересчитать Availability, если вышло 0 при ненулевой цене
+	// (панель могла дорисоваться позже цены); 0 — defaultAvailabilityRecheck.
+	AvailabilityPanel   string
+	AvailabilityRecheck time.Duration
+
+	// PriceRegexp вырезает число из текста Price ("от 23 руб." -> "23").
+	// Если в нём есть группа (?P<price>...), берётся она, иначе всё совпадение.
+	// Пусто — DefaultPriceRegexp.
+	PriceRegexp string
+
+	// DecimalSeparator — десятичный разделитель цены на странице: "," или ".".
+	// Пусто — определить по тексту (см. normalizeDecimal); задаётся, если
+	// поставщик пишет цены вида "1,234" и эвристика ошибается.
+	DecimalSeparator string
+
+	// InStockValue — availableCount для товара "в наличии", когда поставщик
+	// не показывает количество (bubblebags). Значение должно совпадать
+	// с AvailableCount в таблице остатков (amountTable), иначе calcAmount
+	// вернёт 0 и товар уйдёт на WB с нулевым остатком. 0 — DefaultInStockValue.
+	// С Config.DefaultInStockAmount таблица для таких товаров не используется.
+	InStockValue int
+
+	// InStockTexts — фразы в тексте Stock, означающие "в наличии" ("Есть в наличии",
+	// "На складе"); совпадение по подстроке с учётом регистра, чтобы "Нет в наличии"
+	// не сошло за "В наличии". InStockRegexp проверяется вместо них, если задан.
+	// Оба пусты — DefaultInStockTexts.
+	InStockTexts  []string
+	InStockRegexp string
+
+	// Blocker и BlockerTexts опознают страницу-заглушку (CAPTCHA, проверка
+	// "вы не робот") вместо товара: элемент по селектору или фраза в тексте
+	// страницы. Такой парсинг — ErrScrapeBlocked, а не отсутствие товара.
+	Blocker      string
+	BlockerTexts []string
+
+	// TierPrice — селектор цены за штуку на ступени "от N штук", с %d вместо N,
+	// например `button[data-count="%d"] .col_right`. Если ступень под pcs карточки
+	// есть на странице, cost = её цена × pcs, иначе — цена Price × pcs. Пусто — без ступеней.
+	TierPrice string
+}
+
+// DefaultInStockTexts — фраза, которую bubblebags показывает у товара в наличии.
+var DefaultInStockTexts = []string{"В наличии"}
+
+// isInStock проверяет текст наличия по InStockRegexp или InStockTexts поставщика.
+func isInStock(stock string, sel SupplierSelectors) (bool, error) {
+	if sel.InStockRegexp != "" {
+		re, err := regexp.Compile(sel.InStockRegexp)
+		if err != nil {
+			return false, fmt.Errorf("некорректный InStockRegexp %q: %v", sel.InStockRegexp, err)
+		}
+		return re.MatchString(stock), nil
+	}
+	texts := sel.InStockTexts
+	if len(texts) == 0 {
+		texts = DefaultInStockTexts
+	}
+	for _, t := range texts {
+		if t != "" && strings.Contains(stock, t) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DefaultInStockValue — прежнее захардкоженное значение: под него написаны
+// правила defaultAmountTable с AvailableCount = 5.
+const DefaultInStockValue = 5
+
+// DefaultPriceRegexp — первое число в тексте, с разделителями разрядов и дробной частью.
+const DefaultPriceRegexp = `\d[\d\s\x{00a0}\x{2009}\x{202f}]*(?:[.,]\d+)*`
+
+var defaultSelectors = map[string]SupplierSelectors{
+	supplierBubblebags: {
+		Price: `button[data-count="1"] .col_right`,
+		Stock: `div.quantity span.stock`,
+	},
+	supplierCargoAvto: {
+		Price:        `li[data-min="1"] .price-val`,
+		Tab:          `li.tabs-item a[href="#samovivoz-tabs"]`,
+		Availability: `.avail-item-status.avail`,
+	},
+}
+
+// chromeOptions — опции запуска браузера: встроенные, затем WindowSize и
+// ChromeFlags из конфига. Более поздний флаг с тем же именем побеждает, так что
+// ChromeFlags может переопределить и встроенные ("--headless=true").
+func chromeOptions(cfg Config) ([]chromedp.ExecAllocatorOption, error) {
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.Flag("headless", false),
+		chromedp.Flag("disable-gpu", true),
+	)
+	if cfg.ChromePath != "" {
+		opts = append(opts, chromedp.ExecPath(cfg.ChromePath))
+	}
+	if cfg.ChromeUserDataDir != "" {
+		opts = append(opts, chromedp.UserDataDir(cfg.ChromeUserDataDir))
+	}
+	if cfg.WindowSize != "" {
+		var w, h int
+		if _, err := fmt.Sscanf(cfg.WindowSize, "%dx%d", &w, &h); err != nil || w <= 0 || h <= 0 {
+			return nil, fmt.Errorf("некорректный WindowSize %q, нужен вид 1280x800", cfg.WindowSize)
+		}
+		opts = append(opts, chromedp.WindowSize(w, h))
+	}
+	for _, f := range cfg.ChromeFlags {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(strings.TrimSpace(f), "-"), "=")
+		if name == "" {
+			return nil, fmt.Errorf("пустой флаг в ChromeFlags: %q", f)
+		}
+		switch {
+		case !hasValue:
+			opts = append(opts, chromedp.Flag(name, true))
+		case value == "true" || value == "false":
+			opts = append(opts, chromedp.Flag(name, value == "true"))
+		default:
+			opts = append(opts, chromedp.Flag(name, value))
+		}
+	}
+	return opts, nil
+}
+
+// newChromeContext запускает браузер и открывает в нём вкладку.
+func newChromeContext(parent context.Context, cfg Config) (context.Context, context.CancelFunc, error) {
+	opts, err := chromeOptions(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	allocCtx, allocCancel := chromedp.NewExecAllocator(parent, opts...)
+	ctx, ctxCancel := chromedp.NewContext(allocCtx)
+	return ctx, func() {
+		ctxCancel()
+		allocCancel()
+	}, nil
+}
+
+// startChrome — newChromeContext с проверкой, что браузер запустился. Без неё
+// отсутствие Chrome всплывало бы глубоко в парсинге первой страницы.
+func startChrome(parent context.Context, cfg Config) (context.Context, context.CancelFunc, error) {
+	ctx, cancel, err := newChromeContext(parent, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		if parent.Err() != nil {
+			return nil, nil, parent.Err()
+		}
+		path := cfg.ChromePath
+		if path == "" {
+			path = "поиск в PATH"
+		}
+		return nil, nil, fmt.Errorf("не удалось запустить Chrome/Chromium (%s): %v — установите его или укажите путь в ChromePath", path, err)
+	}
+	return ctx, cancel, nil
+}
+
+// bubblebagsVendorCode — артикулы, цена которых берётся со страниц bubblebags из CSV.
+var bubblebagsVendorCode = regexp.MustCompile(`^bubblebags_1\d+_\d+$`)
+
+// supplierForVendorCode — с чьей страницы scrapeProductData берёт цену артикула.
+func supplierForVendorCode(vendorCode string) string {
+	if bubblebagsVendorCode.MatchString(vendorCode) {
+		return supplierBubblebags
+	}
+	return supplierCargoAvto
+}
+
+// tierPriceKey — ключ цены ступени pcs в данных scrapeProductData.
+func tierPriceKey(pcs int) string {
+	return fmt.Sprintf("price:%d", pcs)
+}
+
+// addTierPrices добавляет в data цены найденных на странице ступеней.
+func addTierPrices(data map[string]string, page pageFields, sel SupplierSelectors, priceRe *regexp.Regexp) {
+	for pcs, raw := range page.TierPrices {
+		price := extractPrice(raw, priceRe, sel.DecimalSeparator)
+		if v, err := strconv.ParseFloat(price, 64); err == nil && v > 0 {
+			data[tierPriceKey(pcs)] = price
+		}
+	}
+}
+
+// scrapeProductData читает цену и наличие товара; tiers — pcs карточек, для
+// которых стоит поискать цену ступени (SupplierSelectors.TierPrice).
+func scrapeProductData(ctx context.Context, cfg Config, vc vendorCode, tiers []int) (map[string]string, error) {
+	vendorCode := vc.Raw
+	// Проверяем: ^bubblebags_1\d+_\d+$
+	if supplierForVendorCode(vendorCode) == supplierBubblebags {
+		// Пример: "bubblebags_19336_100"
+		// Нам нужно отбросить "_100", чтобы найти "bubblebags_19336" в CSV
+		csvURL, ok := bubblebagsURL(vendorCode)
+		if !ok {
+			log.Printf("Не найден URL для %s в %s", vendorCode, cfg.BubblebagsCSV)
+			return map[string]string{"price": "0", "availableCount": "0"}, nil
+		}
+
+		sel := cfg.Selectors[supplierBubblebags]
+		fetcher, err := fetcherFor(cfg, supplierBubblebags)
+		if err != nil {
+			return nil, err
+		}
+		page, err := fetcher.Fetch(ctx, csvURL, sel, tiers)
+		if err != nil {
+			return nil, err
+		}
+		htmlStock, htmlPrice := page.Stock, page.Price
+
+		// Проверяем наличие. Количества на странице нет, поэтому "в наличии"
+		// превращается в InStockValue, под которое настроена amountTable
+		inStock, err := isInStock(htmlStock, sel)
+		if err != nil {
+			return nil, err
+		}
+		var availableCount int
+		if inStock {
+			availableCount = sel.InStockValue
+			if availableCount <= 0 {
+				availableCount = DefaultInStockValue
+			}
+		} else {
+			availableCount = 0
+		}
+
+		// Извлекаем число из htmlPrice (например, "23 руб.")
+		rawPrice := extractPrice(htmlPrice, cfg.priceRegexps[supplierBubblebags], sel.DecimalSeparator)
+		if rawPrice == "" {
+			rawPrice = "0"
+		}
+		if err := checkZeroPriceInStock(cfg, csvURL, rawPrice, availableCount); err != nil {
+			return nil, err
+		}
+		data := map[string]string{
+			"price":          rawPrice,
+			"availableCount": fmt.Sprintf("%d", availableCount),
+		}
+		addTierPrices(data, page, sel, cfg.priceRegexps[supplierBubblebags])
+		return data, nil
+	}
+
+	// Остальной код для "box_\d+_\d+$" и т. д.
+	// (пример парсинга sp.cargo-avto.ru)
+	url := productURL(cfg, vc)
+	sel := cfg.Selectors[supplierCargoAvto]
+
+	fetcher, err := fetcherFor(cfg, supplierCargoAvto)
+	if err != nil {
+		return nil, err
+	}
+	page, err := fetcher.Fetch(ctx, url, sel, tiers)
+	if err != nil {
+		return nil, err
+	}
+	productPrice, availableStoresCount := page.Price, page.AvailableCount
+
+	// Слишком мало магазинов с товаром — считаем, что его нет
+	if availableStoresCount < cfg.MinAvailableStores {
+		availableStoresCount = 0
+	}
+
+	price := extractPrice(productPrice, cfg.priceRegexps[supplierCargoAvto], sel.DecimalSeparator)
+	if err := checkZeroPriceInStock(cfg, url, price, availableStoresCount); err != nil {
+		return nil, err
+	}
+	data := map[string]string{
+		"price":          price,
+		"availableCount": fmt.Sprintf("%d", availableStoresCount),
+	}
+	addTierPrices(data, page, sel, cfg.priceRegexps[supplierCargoAvto])
+	return data, nil
+}
+
+// bubblebagsURL ищет страницу bubblebags в CSV по артикулу без суффикса pcs.
+func bubblebagsURL(vendorCode string) (string, bool) {
+	baseKey := vendorCode
+	if idx := strings.LastIndex(baseKey, "_"); idx != -1 {
+		// baseKey = "bubblebags_19336"
+		baseKey = baseKey[:idx]
+	}
+	// Ищем URL в карте, загруженной из CSV
+	u, ok := bubblebagsURLMap[baseKey]
+	return u, ok
+}
+
+// productURL — страница поставщика для артикула; пусто, если адреса нет в CSV.
+func productURL(cfg Config, vc vendorCode) string {
+	if supplierForVendorCode(vc.Raw) == supplierBubblebags {
+		u, _ := bubblebagsURL(vc.Raw)
+		return u
+	}
+	return cfg.CargoAvtoBaseURL + vc.ProductID + "/"
+}
+
+// checkZeroPriceInStock отбраковывает нулевую цену у товара в наличии: так
+// выглядит страница, где не сработал селектор цены, а наличие прочиталось.
+// Бесплатных товаров у поставщиков нет, поэтому это ошибка парсинга, а не цена.
+func checkZeroPriceInStock(cfg Config, url, price string, availableCount int) error {
+	if cfg.AllowZeroPriceInStock || availableCount <= 0 {
+		return nil
+	}
+	if v, err := strconv.ParseFloat(price, 64); err == nil && v > 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s (цена %q, наличие %d)", ErrZeroPriceInStock, url, price, availableCount)
+}
+
+// defaultPriceRegexp — скомпилированный DefaultPriceRegexp.
+var defaultPriceRegexp = regexp.MustCompile(DefaultPriceRegexp)
+
+// compilePriceRegexps компилирует PriceRegexp поставщиков один раз, при
+// проверке конфига, а не на каждую страницу. Пустой шаблон — DefaultPriceRegexp.
+func compilePriceRegexps(cfg Config) (map[string]*regexp.Regexp, error) {
+	res := make(map[string]*regexp.Regexp, len(cfg.Selectors))
+	for supplier, sel := range cfg.Selectors {
+		if sel.PriceRegexp == "" {
+			res[supplier] = defaultPriceRegexp
+			continue
+		}
+		re, err := regexp.Compile(sel.PriceRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный PriceRegexp %q для %s: %v", sel.PriceRegexp, supplier, err)
+		}
+		res[supplier] = re
+	}
+	return res, nil
+}
+
+// extractPrice находит цену в тексте по регулярке re (nil — DefaultPriceRegexp)
+// и чистит её cleanPrice. Пустая строка означает, что числа в тексте нет.
+func extractPrice(raw string, re *regexp.Regexp, decimalSep string) string {
+	if re == nil {
+		re = defaultPriceRegexp
+	}
+	m := re.FindStringSubmatch(raw)
+	if m == nil {
+		return ""
+	}
+	match := m[0]
+	if idx := re.SubexpIndex("price"); idx >= 0 {
+		match = m[idx]
+	}
+	return cleanPrice(match, decimalSep)
+}
+
+// priceJunkReplacer убирает валюту и мусор, который встречается в ценах
+// поставщиков. Порядок важен: длинные варианты идут раньше коротких.
+var priceJunkReplacer = strings.NewReplacer(
+	"руб.", "",
+	"руб", "",
+	"₽", "",
+	"р.", "",
+	"р", "",
+	"p", "",
+	"№", "",
+)
+
+// cleanPrice приводит сырой текст цены со страницы поставщика к виду,
+// понятному strconv.ParseFloat: "1 234,50 руб." -> "1234.50".
+func cleanPrice(raw, decimalSep string) string {
+	s := priceJunkReplacer.Replace(raw)
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.Trim(normalizeDecimal(s, decimalSep), ".")
+}
+
+// normalizeDecimal оставляет точку как единственный десятичный разделитель.
+// Если decimalSep задан, второй символ считается разделителем разрядов.
+// Иначе: при наличии и точки, и запятой десятичный — тот, что правее
+// ("1,234.50" и "1.234,50" -> "1234.50"); повторяющийся символ — разделитель
+// разрядов ("1.234.567"); одиночная запятая — десятичная, как принято в рублёвых ценах.
+func normalizeDecimal(s, decimalSep string) string {
+	switch decimalSep {
+	case ",":
+		return strings.ReplaceAll(strings.ReplaceAll(s, ".", ""), ",", ".")
+	case ".":
+		return strings.ReplaceAll(s, ",", "")
+	}
+
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastComma > lastDot {
+			return normalizeDecimal(s, ",")
+		}
+		return normalizeDecimal(s, ".")
+	case lastComma >= 0:
+		if strings.Count(s, ",") > 1 {
+			return strings.ReplaceAll(s, ",", "")
+		}
+		return strings.Replace(s, ",", ".", 1)
+	case lastDot >= 0 && strings.Count(s, ".") > 1:
+		return strings.ReplaceAll(s, ".", "")
+	}
+	return s
+}
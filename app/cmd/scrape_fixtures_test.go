@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// newFixtureServer отдаёт страницы из testdata по путям routes; остальное — 404.
+func newFixtureServer(t *testing.T, routes map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeFile(w, r, filepath.Join("testdata", file))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// fixtureBackends — бэкенды, через которые прогоняются фикстуры. chrome — тот
+// путь, которым парсится прод (клик по вкладке, ожидание цены); без Chrome
+// пропускается. http — дополнительное покрытие, которое работает везде.
+var fixtureBackends = []string{backendChrome, backendHTTP}
+
+// fixtureConfig — конфиг с backend для обоих поставщиков и контекст парсинга:
+// для chrome — вкладка запущенного браузера.
+func fixtureConfig(t *testing.T, srv *httptest.Server, backend string) (context.Context, Config) {
+	t.Helper()
+	cfg := testConfig(t, filepath.Join(t.TempDir(), "test.db"))
+	cfg.CargoAvtoBaseURL = srv.URL + "/product/"
+	cfg.ScrapeBackends = map[string]string{
+		supplierBubblebags: backend,
+		supplierCargoAvto:  backend,
+	}
+	if backend != backendChrome {
+		return context.Background(), cfg
+	}
+
+	cfg.ChromePath = findChrome(t)
+	cfg.ChromeFlags = []string{"headless=true", "no-sandbox"}
+	ctx, cancel, err := startChrome(context.Background(), cfg)
+	if err != nil {
+		t.Skipf("Chrome не запустился: %v", err)
+	}
+	t.Cleanup(cancel)
+	return ctx, cfg
+}
+
+// withBubblebagsURLs подменяет адреса bubblebags из urls.csv на время теста.
+func withBubblebagsURLs(t *testing.T, urls map[string]string) {
+	t.Helper()
+	prev := bubblebagsURLMap
+	bubblebagsURLMap = urls
+	t.Cleanup(func() { bubblebagsURLMap = prev })
+}
+
+func TestScrapeBubblebagsFixture(t *testing.T) {
+	srv := newFixtureServer(t, map[string]string{
+		"/catalog/19336/": "bubblebags_in_stock.html",
+		"/catalog/19400/": "bubblebags_out_of_stock.html",
+	})
+	withBubblebagsURLs(t, map[string]string{
+		"bubblebags_19336": srv.URL + "/catalog/19336/",
+		"bubblebags_19400": srv.URL + "/catalog/19400/",
+	})
+
+	tests := []struct {
+		name  string
+		vc    vendorCode
+		tiers []int
+		want  map[string]string
+	}{
+		{
+			name:  "в наличии, со ступенями",
+			vc:    vendorCode{Raw: "bubblebags_19336_100", ProductID: "bubblebags_19336", Pcs: 100, HasPcs: true},
+			tiers: []int{100, 500},
+			want:  map[string]string{"price": "23.40", "availableCount": "5", tierPriceKey(100): "21.10"},
+		},
+		{
+			name:  "нет в наличии",
+			vc:    vendorCode{Raw: "bubblebags_19400_10", ProductID: "bubblebags_19400", Pcs: 10, HasPcs: true},
+			tiers: []int{10},
+			want:  map[string]string{"price": "41", "availableCount": "0"},
+		},
+		{
+			name: "нет адреса в CSV",
+			vc:   vendorCode{Raw: "bubblebags_19999_10", ProductID: "bubblebags_19999", Pcs: 10, HasPcs: true},
+			want: map[string]string{"price": "0", "availableCount": "0"},
+		},
+	}
+	for _, backend := range fixtureBackends {
+		t.Run(backend, func(t *testing.T) {
+			ctx, cfg := fixtureConfig(t, srv, backend)
+			sel := cfg.Selectors[supplierBubblebags]
+			sel.TierPrice = `button[data-count="%d"] .col_right`
+			cfg.Selectors[supplierBubblebags] = sel
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					got, err := scrapeProductData(ctx, cfg, tt.vc, tt.tiers)
+					if err != nil {
+						t.Fatalf("scrapeProductData: %v", err)
+					}
+					assertScrapeData(t, got, tt.want)
+				})
+			}
+		})
+	}
+}
+
+func TestScrapeCargoAvtoFixture(t *testing.T) {
+	srv := newFixtureServer(t, map[string]string{
+		"/product/12345/": "cargo_avto_product.html",
+	})
+	vc := vendorCode{Raw: "box_12345_10", ProductID: "12345", Pcs: 10, HasPcs: true}
+
+	tests := []struct {
+		name      string
+		minStores int
+		want      map[string]string
+	}{
+		{"магазины с товаром", 0, map[string]string{"price": "1234.50", "availableCount": "4"}},
+		{"магазинов меньше MinAvailableStores", 5, map[string]string{"price": "1234.50", "availableCount": "0"}},
+	}
+	for _, backend := range fixtureBackends {
+		t.Run(backend, func(t *testing.T) {
+			ctx, cfg := fixtureConfig(t, srv, backend)
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					cfg := cfg
+					if tt.minStores > 0 {
+						cfg.MinAvailableStores = tt.minStores
+					}
+					got, err := scrapeProductData(ctx, cfg, vc, []int{10})
+					if err != nil {
+						t.Fatalf("scrapeProductData: %v", err)
+					}
+					assertScrapeData(t, got, tt.want)
+				})
+			}
+		})
+	}
+}
+
+// Комбинаторы, псевдоклассы и списки селекторов — как в браузере.
+func TestScrapeCargoAvtoFixtureFullCSS(t *testing.T) {
+	srv := newFixtureServer(t, map[string]string{
+		"/product/12345/": "cargo_avto_product.html",
+	})
+	vc := vendorCode{Raw: "box_12345_10", ProductID: "12345", Pcs: 10, HasPcs: true}
+
+	for _, backend := range fixtureBackends {
+		t.Run(backend, func(t *testing.T) {
+			ctx, cfg := fixtureConfig(t, srv, backend)
+			sel := cfg.Selectors[supplierCargoAvto]
+			sel.Price = `ul.price-list > li:first-child .price-val`
+			sel.Availability = `.avail-item > .avail-item-status.avail, .avail-item > .in-stock`
+			cfg.Selectors[supplierCargoAvto] = sel
+
+			got, err := scrapeProductData(ctx, cfg, vc, nil)
+			if err != nil {
+				t.Fatalf("scrapeProductData: %v", err)
+			}
+			assertScrapeData(t, got, map[string]string{"price": "1234.50", "availableCount": "4"})
+		})
+	}
+}
+
+func TestScrapeFixtureErrors(t *testing.T) {
+	srv := newFixtureServer(t, map[string]string{
+		"/product/777/": "blocked.html",
+	})
+
+	tests := []struct {
+		name string
+		vc   vendorCode
+		want error
+	}{
+		{"страницы нет", vendorCode{Raw: "box_404_10", ProductID: "404", Pcs: 10}, ErrPageNotFound},
+		{"заглушка от ботов", vendorCode{Raw: "box_777_10", ProductID: "777", Pcs: 10}, ErrScrapeBlocked},
+	}
+	for _, backend := range fixtureBackends {
+		t.Run(backend, func(t *testing.T) {
+			ctx, cfg := fixtureConfig(t, srv, backend)
+			sel := cfg.Selectors[supplierCargoAvto]
+			sel.BlockerTexts = []string{"не робот"}
+			cfg.Selectors[supplierCargoAvto] = sel
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					_, err := scrapeProductData(ctx, cfg, tt.vc, nil)
+					if !errors.Is(err, tt.want) {
+						t.Errorf("ошибка %v, want %v", err, tt.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func assertScrapeData(t *testing.T, got, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("данные %v, want %v", got, want)
+		return
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q (все данные %v)", k, got[k], v, got)
+		}
+	}
+}
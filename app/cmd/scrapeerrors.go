@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Классы ошибок парсинга. Повторять имеет смысл ErrScrapeTimeout и
+// ErrZeroPriceInStock (цена могла не успеть отрисоваться): отсутствующая
+// страница или селектор при повторе не появятся.
+var (
+	ErrPageNotFound     = errors.New("страница не найдена")
+	ErrScrapeTimeout    = errors.New("таймаут парсинга")
+	ErrSelectorMissing  = errors.New("селектор не найден на странице")
+	ErrZeroPriceInStock = errors.New("нулевая цена у товара в наличии")
+	ErrScrapeBlocked    = errors.New("поставщик показал заглушку от ботов")
+)
+
+// isTransientScrapeError сообщает, стоит ли повторять парсинг.
+func isTransientScrapeError(err error) bool {
+	return errors.Is(err, ErrScrapeTimeout) || errors.Is(err, ErrZeroPriceInStock)
+}
+
+// classifyScrapeError оборачивает ошибку chromedp в один из классов выше.
+func classifyScrapeError(url string, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s: %v", ErrScrapeTimeout, url, err)
+	}
+	return fmt.Errorf("ошибка парсинга страницы %s: %w", url, err)
+}
+
+// navigate открывает страницу и проверяет HTTP-статус основного документа.
+func navigate(ctx context.Context, url string) error {
+	resp, err := chromedp.RunResponse(ctx, chromedp.Navigate(url))
+	if err != nil {
+		return classifyScrapeError(url, err)
+	}
+	if resp != nil && (resp.Status == http.StatusNotFound || resp.Status == http.StatusGone) {
+		return fmt.Errorf("%w: %s (статус %d)", ErrPageNotFound, url, resp.Status)
+	}
+	return nil
+}
+
+// requireSelector падает с ErrSelectorMissing, если элемента нет в DOM.
+// Без этой проверки chromedp.Text ждал бы селектор до таймаута.
+func requireSelector(sel string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		var found bool
+		js := fmt.Sprintf(`document.querySelector(%q) !== null`, sel)
+		if err := chromedp.Evaluate(js, &found).Do(ctx); err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%w: %s", ErrSelectorMissing, sel)
+		}
+		return nil
+	})
+}
+
+// scrapeWithRetry вызывает scrapeProductData с таймаутом на каждую попытку
+// и повторяет только временные ошибки.
+func scrapeWithRetry(ctx context.Context, cfg Config, vc vendorCode, tiers []int) (map[string]string, error) {
+	data, err := scrapeAttempts(ctx, cfg, vc, tiers)
+	if err != nil {
+		return nil, fmt.Errorf("vendorCode=%s: %w", vc.Raw, err)
+	}
+	return data, nil
+}
+
+func scrapeAttempts(ctx context.Context, cfg Config, vc vendorCode, tiers []int) (map[string]string, error) {
+	var data map[string]string
+	err := retry(ctx, "парсинг vendorCode="+vc.Raw, cfg.Retry.Scrape, func(int) error {
+		attemptCtx, cancel := context.WithTimeout(ctx, cfg.ScrapeTimeout)
+		defer cancel()
+		var err error
+		data, err = scrapeProductData(attemptCtx, cfg, vc, tiers)
+		if err != nil && !isTransientScrapeError(err) {
+			return permanent(err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
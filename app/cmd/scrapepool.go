@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/chromedp/chromedp"
+)
+
+// cardJob — карточка WB, которая получит цену со страницы товара.
+type cardJob struct {
+	Card    Card
+	Pattern string // сработавший VendorCodePatterns, для статистики
+	Pcs     int
+	SKU     string
+}
+
+// scrapeJob — одна страница поставщика и все карточки, которые с неё берут цену.
+//
+// Несколько карточек на один productID — обычное дело: box_500_10 и box_500_30
+// продают одну коробку упаковками по 10 и 30 штук. Страница парсится один раз,
+// и все карточки получают одну и ту же цену за штуку и одно и то же
+// availableCount, поэтому наличие между ними согласовано по построению.
+// Различаются они только pcs: cost = цена × pcs, а остаток — calcAmount(pcs,
+// availableCount), так что при availableCount = 5 строки (500, 10) и (500, 30)
+// получат 5 и 2 по defaultAmountTable. В products это разные строки благодаря
+// UNIQUE (product_id, pcs).
+type scrapeJob struct {
+	ProductID string
+	VC        vendorCode
+	Cards     []cardJob
+}
+
+// tiers — pcs карточек задания больше 1: для них ищутся цены ступеней.
+func (j *scrapeJob) tiers() []int {
+	var tiers []int
+	seen := make(map[int]bool)
+	for _, cj := range j.Cards {
+		if cj.Pcs > 1 && !seen[cj.Pcs] {
+			seen[cj.Pcs] = true
+			tiers = append(tiers, cj.Pcs)
+		}
+	}
+	return tiers
+}
+
+type scrapeResult struct {
+	Job  *scrapeJob
+	Data map[string]string
+	Err  error
+}
+
+// runScrapeWorkers парсит страницы в cfg.ScrapeWorkers вкладках одного браузера.
+// Канал результатов закрывается, когда все задания обработаны или browserCtx отменён.
+func runScrapeWorkers(browserCtx context.Context, cfg Config, jobs []*scrapeJob) <-chan scrapeResult {
+	workers := cfg.ScrapeWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	results := make(chan scrapeResult)
+	if workers > 1 {
+		// Дочерние вкладки открываются только в уже запущенном браузере
+		if err := chromedp.Run(browserCtx); err != nil {
+			log.Printf("Не удалось запустить браузер, парсим в одной вкладке: %v", err)
+			workers = 1
+		}
+	}
+
+	jobCh := make(chan *scrapeJob)
+	go func() {
+		defer close(jobCh)
+		for _, job := range jobs {
+			select {
+			case jobCh <- job:
+			case <-browserCtx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			tabCtx := browserCtx
+			if worker > 0 {
+				var cancel context.CancelFunc
+				tabCtx, cancel = chromedp.NewContext(browserCtx)
+				defer cancel()
+			}
+
+			first := true
+			for job := range jobCh {
+				// Пауза между товарами в каждой вкладке, чтобы не попасть под защиту от ботов
+				if !first {
+					if err := sleepCtx(tabCtx, jittered(cfg.ScrapeDelay, cfg.ScrapeJitter)); err != nil {
+						return
+					}
+				}
+				first = false
+
+				log.Printf("Парсим страницу для товара: %s", job.ProductID)
+				data, err := scrapeWithRetry(tabCtx, cfg, job.VC, job.tiers())
+				results <- scrapeResult{Job: job, Data: data, Err: err}
+				// Поставщик включил защиту — даём ей остыть, прежде чем идти дальше
+				if errors.Is(err, ErrScrapeBlocked) && cfg.BlockedPause > 0 {
+					log.Printf("🚫 Пауза %s после заглушки от ботов", cfg.BlockedPause)
+					if err := sleepCtx(tabCtx, cfg.BlockedPause); err != nil {
+						return
+					}
+				}
+			}
+		}(i)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
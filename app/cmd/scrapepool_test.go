@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestScrapeJobSharedPage прогоняет box_500_10 и box_500_30 через одно задание:
+// страница парсится один раз, cost различается по pcs, наличие общее.
+func TestScrapeJobSharedPage(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/product/500/" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&hits, 1)
+		http.ServeFile(w, r, filepath.Join("testdata", "cargo_avto_product.html"))
+	}))
+	t.Cleanup(srv.Close)
+
+	db, path := newTestDB(t)
+	_, cfg := fixtureConfig(t, srv, backendHTTP)
+	cfg.DBName = path
+
+	job := &scrapeJob{
+		ProductID: "500",
+		VC:        vendorCode{Raw: "box_500_10", ProductID: "500", Pcs: 10, HasPcs: true},
+		Cards: []cardJob{
+			{Card: Card{NmID: 1, VendorCode: "box_500_10"}, Pcs: 10, SKU: "2000000000011"},
+			{Card: Card{NmID: 2, VendorCode: "box_500_30"}, Pcs: 30, SKU: "2000000000028"},
+		},
+	}
+
+	var result ProcessResult
+	stats := newScrapeStats()
+	for res := range runScrapeWorkers(context.Background(), cfg, []*scrapeJob{job}) {
+		saveScrapeResult(db, cfg, stats, nil, res, &result)
+	}
+	if hits != 1 {
+		t.Errorf("страница запрошена %d раз, want 1", hits)
+	}
+	if result.PagesScraped != 1 || result.RowsSaved != 2 || result.ScrapeFailures != 0 {
+		t.Fatalf("результат %+v, want 1 страницу и 2 строки", result)
+	}
+
+	// Цена на странице 1234,50 за штуку, магазинов с товаром 4. Без
+	// RoundAfterMultiply цена за штуку округляется до 1235 перед умножением
+	rows, err := db.Query(`SELECT vendor_code, pcs, cost, available_count FROM products WHERE product_id = '500' ORDER BY pcs`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type row struct {
+		VendorCode       string
+		Pcs, Cost, Avail int
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.VendorCode, &r.Pcs, &r.Cost, &r.Avail); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	want := []row{
+		{"box_500_10", 10, 12350, 4},
+		{"box_500_30", 30, 37050, 4},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("строки %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("строка %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Остатки по defaultAmountTable: (4, 10) -> 3, (4, 30) -> 1
+	plan, _, err := buildStockPlan(db, cfg, map[string]int{})
+	if err != nil {
+		t.Fatalf("buildStockPlan: %v", err)
+	}
+	amounts := make(map[string]int)
+	for _, item := range plan {
+		amounts[item.Vendor] = item.Amount
+	}
+	if amounts["box_500_10"] != 3 || amounts["box_500_30"] != 1 || len(amounts) != 2 {
+		t.Errorf("остатки %v, want box_500_10=3, box_500_30=1", amounts)
+	}
+}
+
+// TestRecountAvailabilityRace: цена уже есть, а магазины появляются, пока
+// recountAvailability ждёт AvailabilityRecheck. Запускать с -race.
+func TestRecountAvailabilityRace(t *testing.T) {
+	sel := SupplierSelectors{Availability: ".avail", AvailabilityRecheck: 100 * time.Millisecond}
+
+	tests := []struct {
+		name       string
+		price      string
+		stores     int   // магазинов при первом подсчёте
+		lateStores int32 // магазинов, дорисованных позже
+		wantStores int
+		wantCounts int32
+	}{
+		{"магазины дорисовались после цены", "1 234,50 ₽", 0, 3, 3, 1},
+		{"магазинов действительно нет", "1 234,50 ₽", 0, 0, 0, 1},
+		{"магазины посчитались сразу", "1 234,50 ₽", 2, 3, 2, 0},
+		{"цены нет — пересчёт не нужен", "0 ₽", 0, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Панель магазинов отрисовывается в другой горутине, как JS страницы
+			var rendered, counts int32
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				atomic.StoreInt32(&rendered, tt.lateStores)
+			}()
+			count := func(context.Context) (int, error) {
+				atomic.AddInt32(&counts, 1)
+				return int(atomic.LoadInt32(&rendered)), nil
+			}
+
+			f := pageFields{Price: tt.price, AvailableCount: tt.stores}
+			if err := recountAvailability(context.Background(), "http://test/", &f, sel, count); err != nil {
+				t.Fatalf("recountAvailability: %v", err)
+			}
+			if f.AvailableCount != tt.wantStores {
+				t.Errorf("магазинов %d, want %d", f.AvailableCount, tt.wantStores)
+			}
+			if got := atomic.LoadInt32(&counts); got != tt.wantCounts {
+				t.Errorf("подсчётов %d, want %d", got, tt.wantCounts)
+			}
+		})
+	}
+
+	t.Run("отмена во время ожидания", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		f := pageFields{Price: "100"}
+		err := recountAvailability(ctx, "http://test/", &f, sel, func(context.Context) (int, error) {
+			t.Error("подсчёт после отмены")
+			return 0, nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ошибка %v, want context.Canceled", err)
+		}
+	})
+}
+
+// TestRunScrapeWorkersAvailabilityRace парсит в Chrome несколько вкладок со
+// страницей, где магазины дорисовываются через 500 мс после цены. Без Chrome пропускается.
+func TestRunScrapeWorkersAvailabilityRace(t *testing.T) {
+	chromePath := findChrome(t)
+
+	srv := newFixtureServer(t, map[string]string{
+		"/product/1/": "cargo_avto_late_stores.html",
+		"/product/2/": "cargo_avto_late_stores.html",
+		"/product/3/": "cargo_avto_late_stores.html",
+	})
+	cfg := testConfig(t, filepath.Join(t.TempDir(), "test.db"))
+	cfg.CargoAvtoBaseURL = srv.URL + "/product/"
+	cfg.ChromePath = chromePath
+	cfg.ChromeFlags = []string{"headless=true", "no-sandbox"}
+	cfg.ScrapeWorkers = 3
+	sel := cfg.Selectors[supplierCargoAvto]
+	sel.Tab = ""
+	sel.AvailabilityPanel = ".avail-list"
+	sel.AvailabilityRecheck = time.Second
+	cfg.Selectors[supplierCargoAvto] = sel
+
+	ctx, cancel, err := startChrome(context.Background(), cfg)
+	if err != nil {
+		t.Skipf("Chrome не запустился: %v", err)
+	}
+	defer cancel()
+
+	var jobs []*scrapeJob
+	for i := 1; i <= 3; i++ {
+		id := fmt.Sprint(i)
+		jobs = append(jobs, &scrapeJob{ProductID: id, VC: vendorCode{Raw: "box_" + id + "_10", ProductID: id, Pcs: 10, HasPcs: true}})
+	}
+	var n int
+	for res := range runScrapeWorkers(ctx, cfg, jobs) {
+		n++
+		if res.Err != nil {
+			t.Errorf("%s: %v", res.Job.ProductID, res.Err)
+			continue
+		}
+		if res.Data["availableCount"] != "3" || res.Data["price"] != "1234.50" {
+			t.Errorf("%s: данные %v, want 3 магазина и цену 1234.50", res.Job.ProductID, res.Data)
+		}
+	}
+	if n != len(jobs) {
+		t.Errorf("результатов %d, want %d", n, len(jobs))
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+//go:embed fixtures/selftest.html
+var selftestPage []byte
+
+// Что должен увидеть парсер на fixtures/selftest.html.
+const (
+	selftestPrice  = "1234.50"
+	selftestStores = 3
+)
+
+// selftestSelectors — селекторы тестовой страницы, не зависящие от поставщиков.
+var selftestSelectors = SupplierSelectors{Price: "#price", Availability: ".store"}
+
+// selftestCheck — одна проверка selftest: имя и функция, возвращающая
+// пояснение при успехе или ошибку.
+type selftestCheck struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// runSelftest проверяет, что окружение готово к прогону: БД пишется, Chrome
+// запускается и парсит страницу, токен WB принимается. Печатает результат по
+// каждой проверке и возвращает ошибку, если хоть одна не прошла.
+func runSelftest(cfg Config, apiKey string) error {
+	checks := []selftestCheck{
+		{"БД", selftestDB},
+		{"Chrome", func(ctx context.Context) (string, error) { return selftestChrome(ctx, cfg) }},
+		{"WB API", func(ctx context.Context) (string, error) { return selftestWB(ctx, cfg, apiKey) }},
+	}
+
+	var failed int
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Проверка\tРезультат\tПодробности")
+	for _, c := range checks {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*cfg.ScrapeTimeout)
+		start := time.Now()
+		detail, err := c.run(ctx)
+		cancel()
+		status := "OK"
+		if err != nil {
+			status, detail = "FAIL", err.Error()
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s (%s)\n", c.name, status, detail, time.Since(start).Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("не пройдено проверок: %d из %d", failed, len(checks))
+	}
+	return nil
+}
+
+// selftestDB создаёт временную БД и пишет в неё строку products.
+func selftestDB(ctx context.Context) (string, error) {
+	dir, err := os.MkdirTemp("", "cargo_avto_selftest")
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания временной папки: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "selftest.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return "", fmt.Errorf("ошибка при открытии базы данных: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE products (vendor_code TEXT, cost INTEGER)`); err != nil {
+		return "", fmt.Errorf("ошибка создания таблицы: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO products (vendor_code, cost) VALUES ('box_1_10', 100)`); err != nil {
+		return "", fmt.Errorf("ошибка записи: %v", err)
+	}
+	var cost int
+	if err := db.QueryRowContext(ctx, `SELECT cost FROM products WHERE vendor_code = 'box_1_10'`).Scan(&cost); err != nil {
+		return "", fmt.Errorf("ошибка чтения: %v", err)
+	}
+	if cost != 100 {
+		return "", fmt.Errorf("прочитано %d вместо 100", cost)
+	}
+	return "временная БД создана, запись и чтение работают", nil
+}
+
+// selftestChrome поднимает локальный сервер с fixtures/selftest.html и парсит
+// его тем же chromeFetcher, что и страницы поставщиков.
+func selftestChrome(ctx context.Context, cfg Config) (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("ошибка запуска локального сервера: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(selftestPage)
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	chromeCtx, cancel, err := startChrome(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+
+	page, err := chromeFetcher{}.Fetch(chromeCtx, "http://"+ln.Addr().String()+"/", selftestSelectors, nil)
+	if err != nil {
+		return "", err
+	}
+	price := extractPrice(page.Price, nil, "")
+	if price != selftestPrice {
+		return "", fmt.Errorf("цена %q вместо %s (сырой текст %q)", price, selftestPrice, page.Price)
+	}
+	if page.AvailableCount != selftestStores {
+		return "", fmt.Errorf("магазинов %d вместо %d", page.AvailableCount, selftestStores)
+	}
+	return fmt.Sprintf("цена %s, магазинов %d", price, page.AvailableCount), nil
+}
+
+// selftestWB запрашивает одну карточку: проверяет токен и доступность WB.
+func selftestWB(ctx context.Context, cfg Config, apiKey string) (string, error) {
+	if apiKey == "" {
+		return "", fmt.Errorf("не задана переменная окружения WB_API_KEY")
+	}
+	cfg.CardsPageSize = 1
+	client := newWBClient(apiKey, cfg)
+	defer client.Close()
+
+	if _, err := client.getCardsList(ctx, "", 0, cfg.ObjectIDs); err != nil {
+		return "", err
+	}
+	return "токен принят, список карточек отдаётся", nil
+}
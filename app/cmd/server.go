@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// runServer — режим -serve: прогон Process + updateStocks по запросу другого сервиса
+// вместо cron. Одновременно идёт не больше одного прогона.
+type runServer struct {
+	apiKey      string
+	cfg         Config
+	summaryPath string
+	maxRuntime  time.Duration
+	rootCtx     context.Context // отменяется по Ctrl+C / SIGTERM, задаётся в listen
+
+	runMu sync.Mutex // занят на время прогона
+
+	mu      sync.Mutex
+	running bool
+	last    []byte // JSON-сводка последнего завершённого прогона
+}
+
+// listen обслуживает запросы, пока не отменён ctx (Ctrl+C / SIGTERM).
+func (s *runServer) listen(ctx context.Context, addr string) error {
+	s.rootCtx = ctx
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", s.handleRun)
+	mux.HandleFunc("/status", s.handleStatus)
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     mux,
+		BaseContext: func(_ net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), maxRuntimeGrace)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("HTTP-сервер слушает %s: POST /run, GET /status", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleRun запускает прогон и отвечает его сводкой. Если прогон уже идёт — 409.
+func (s *runServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "нужен POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.runMu.TryLock() {
+		http.Error(w, "прогон уже идёт", http.StatusConflict)
+		return
+	}
+	defer s.runMu.Unlock()
+
+	s.setRunning(true)
+	// Прогон привязан к процессу, а не к запросу: обрыв соединения не должен
+	// бросать его на полпути
+	err := s.run(s.rootCtx)
+	writeSummary(s.summaryPath)
+	notifyRun(s.cfg, err)
+	b, mErr := summary.finish()
+	if mErr != nil {
+		log.Printf("Не удалось собрать сводку: %v", mErr)
+	}
+
+	s.mu.Lock()
+	s.running, s.last = false, b
+	s.mu.Unlock()
+
+	status := http.StatusOK
+	if err != nil {
+		log.Printf("Прогон по HTTP завершился с ошибкой: %v", err)
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// run — то же, что main делает для -scrape -push-stock, но с ошибкой вместо выхода.
+func (s *runServer) run(ctx context.Context) error {
+	summary.reset()
+	deadLetters.reset()
+	skipped.reset()
+
+	if s.maxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.maxRuntime)
+		defer cancel()
+	}
+
+	if err := loadScrapeInputs(s.cfg); err != nil {
+		summary.addError(err)
+		return err
+	}
+	if _, err := Process(ctx, s.apiKey, s.cfg); err != nil {
+		summary.addError(err)
+		return fmt.Errorf("ошибка при обработке: %w", err)
+	}
+	if err := checkScrapeFailureRate(s.cfg); err != nil {
+		summary.addError(err)
+		return err
+	}
+	if _, err := updateStocks(ctx, s.apiKey, s.cfg); err != nil {
+		summary.addError(err)
+		return fmt.Errorf("ошибка при обновлении стоки: %w", err)
+	}
+	return nil
+}
+
+func (s *runServer) setRunning(running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = running
+}
+
+// handleStatus отдаёт сводку последнего завершённого прогона и признак, идёт ли новый.
+func (s *runServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "нужен GET", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	running, last := s.running, s.last
+	s.mu.Unlock()
+
+	if last == nil {
+		last = []byte("null")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"running": %t, "last_run": %s}`+"\n", running, last)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Причины, по которым карточка не попала в отправку ещё до парсинга.
+// Неудачи парсинга и отправки берутся из deadLetters, причина — их Stage.
+const (
+	reasonNoSKU          = "no_sku"          // у карточки нет SKU
+	reasonMultiSKU       = "multiple_skus"   // несколько SKU при MultiSKUPolicy = "skip"
+	reasonNoPattern      = "no_pattern"      // артикул не подошёл ни под один шаблон
+	reasonBadVendorCode  = "bad_vendor_code" // шаблон подошёл, но productID/pcs не разобрались
+	reasonNoDownloadData = "no_download_row" // FP-товар, которого нет в download.csv
+	reasonEmptySKU       = "empty_sku"       // строка products с пустым SKU
+)
+
+// skippedItem — строка выгрузки пропущенных товаров (-skipped-export).
+type skippedItem struct {
+	VendorCode string `json:"vendor_code"`
+	NmID       int    `json:"nm_id,omitempty"`
+	ProductID  string `json:"product_id,omitempty"`
+	SKU        string `json:"sku,omitempty"`
+	Reason     string `json:"reason"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// skippedLog собирает товары, пропущенные до парсинга; вместе с deadLetters
+// это все товары, которые не дошли до WB, в одном файле.
+type skippedLog struct {
+	mu    sync.Mutex
+	path  string // пусто — выгрузка выключена
+	items []skippedItem
+}
+
+// skipped заполняется по ходу прогона и пишется рядом со сводкой.
+var skipped = &skippedLog{}
+
+func (s *skippedLog) add(item skippedItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(s.items, item)
+}
+
+func (s *skippedLog) setPath(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+}
+
+// reset очищает список перед новым прогоном в режиме -serve.
+func (s *skippedLog) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = nil
+}
+
+// skuReason — почему pickSKUs не выбрал SKU карточки.
+func skuReason(skus []string) string {
+	if len(skus) == 0 {
+		return reasonNoSKU
+	}
+	return reasonMultiSKU
+}
+
+// write сохраняет пропущенные товары и неудачи из deadLetters в .json или,
+// при любом другом расширении, в CSV с колонкой reason.
+func (s *skippedLog) write(dead *deadLetterLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path == "" {
+		return nil
+	}
+	items := append([]skippedItem{}, s.items...)
+	dead.mu.Lock()
+	for _, f := range dead.items {
+		items = append(items, skippedItem{VendorCode: f.VendorCode, ProductID: f.ProductID, SKU: f.SKU, Reason: f.Stage, Detail: f.Error})
+	}
+	dead.mu.Unlock()
+
+	if strings.EqualFold(filepath.Ext(s.path), ".json") {
+		b, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return fmt.Errorf("ошибка маршалинга %s: %v", s.path, err)
+		}
+		if err := os.WriteFile(s.path, b, 0o644); err != nil {
+			return fmt.Errorf("ошибка записи %s: %v", s.path, err)
+		}
+		return nil
+	}
+
+	f, err := os.Create(s.path)
+	if err != nil {
+		return fmt.Errorf("ошибка создания %s: %v", s.path, err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"vendor_code", "nm_id", "product_id", "sku", "reason", "detail"})
+	for _, it := range items {
+		nmID := ""
+		if it.NmID != 0 {
+			nmID = strconv.Itoa(it.NmID)
+		}
+		w.Write([]string{it.VendorCode, nmID, it.ProductID, it.SKU, it.Reason, it.Detail})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("ошибка записи %s: %v", s.path, err)
+	}
+	return nil
+}
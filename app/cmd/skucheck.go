@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// barcodeLengths — длины штрихкодов, которые выдаёт или принимает WB:
+// EAN-8, UPC-A, EAN-13 (в т. ч. сгенерированные WB "20..."), GTIN-14.
+var barcodeLengths = map[int]bool{8: true, 12: true, 13: true, 14: true}
+
+// maxNmIDLen — nmID карточки WB сейчас не длиннее 9 цифр.
+const maxNmIDLen = 9
+
+// maxSKUWarnings — сколько подозрительных SKU печатать по одному; остальные только считаются.
+const maxSKUWarnings = 20
+
+// skuProblem объясняет, почему значение не похоже на штрихкод WB; "" — похоже.
+// nmIDs — nmID карточек из БД: совпадение с ним почти наверняка значит,
+// что в колонку sku попал не тот идентификатор.
+func skuProblem(sku string, nmIDs map[string]bool) string {
+	if nmIDs[sku] {
+		return "совпадает с nmID карточки"
+	}
+	for _, r := range sku {
+		if r < '0' || r > '9' {
+			return "не число"
+		}
+	}
+	if barcodeLengths[len(sku)] {
+		return ""
+	}
+	if len(sku) <= maxNmIDLen {
+		return fmt.Sprintf("%d цифр — похоже на nmID, а не на штрихкод", len(sku))
+	}
+	return fmt.Sprintf("%d цифр, у штрихкода бывает 8, 12, 13 или 14", len(sku))
+}
+
+// warnSuspiciousSKUs предупреждает о SKU, которые WB, скорее всего, не примет:
+// иначе такие пачки молча не обновляют остатки. Строки не отбрасываются —
+// решение остаётся за WB, лог лишь подсказывает, где искать.
+func warnSuspiciousSKUs(db *sql.DB, items []stockItem) {
+	nmIDs, err := loadNmIDs(db)
+	if err != nil {
+		log.Printf("Не удалось прочитать nmID для проверки SKU: %v", err)
+	}
+	var suspicious int
+	for _, item := range items {
+		problem := skuProblem(item.SKU, nmIDs)
+		if problem == "" {
+			continue
+		}
+		suspicious++
+		if suspicious <= maxSKUWarnings {
+			log.Printf("⚠️ SKU %q (%s) не похож на штрихкод WB: %s", item.SKU, item.Vendor, problem)
+		}
+	}
+	if suspicious > maxSKUWarnings {
+		log.Printf("⚠️ ...и ещё %d подозрительных SKU", suspicious-maxSKUWarnings)
+	}
+	if suspicious > 0 {
+		log.Printf("Подозрительных SKU: %d из %d. Проверьте, что в колонку sku попали баркоды, а не nmID",
+			suspicious, len(items))
+	}
+}
+
+func loadNmIDs(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query(`SELECT DISTINCT nm_id FROM products WHERE nm_id IS NOT NULL AND nm_id != 0`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса nm_id: %v", err)
+	}
+	defer rows.Close()
+
+	nmIDs := make(map[string]bool)
+	for rows.Next() {
+		var nmID int64
+		if err := rows.Scan(&nmID); err != nil {
+			return nil, fmt.Errorf("ошибка чтения nm_id: %v", err)
+		}
+		nmIDs[strconv.FormatInt(nmID, 10)] = true
+	}
+	return nmIDs, rows.Err()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+type scrapeOutcome int
+
+const (
+	outcomeSuccess scrapeOutcome = iota
+	outcomeZeroPrice
+	outcomeError
+)
+
+type scrapeCounts struct {
+	Success   int
+	ZeroPrice int
+	Errors    int
+}
+
+// scrapeStats собирает итоги парсинга по каждому шаблону VendorCode,
+// чтобы в конце прогона было видно, какой поставщик отвалился.
+type scrapeStats struct {
+	order  []string
+	counts map[string]*scrapeCounts
+}
+
+func newScrapeStats() *scrapeStats {
+	return &scrapeStats{counts: make(map[string]*scrapeCounts)}
+}
+
+func (s *scrapeStats) record(pattern string, outcome scrapeOutcome) {
+	c, ok := s.counts[pattern]
+	if !ok {
+		c = &scrapeCounts{}
+		s.counts[pattern] = c
+		s.order = append(s.order, pattern)
+	}
+	switch outcome {
+	case outcomeSuccess:
+		c.Success++
+	case outcomeZeroPrice:
+		c.ZeroPrice++
+	case outcomeError:
+		c.Errors++
+	}
+}
+
+// print выводит таблицу вида: шаблон | успешно | нулевая цена | ошибки.
+func (s *scrapeStats) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Шаблон\tУспешно\tЦена 0\tОшибки")
+	var total scrapeCounts
+	for _, pattern := range s.order {
+		c := s.counts[pattern]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", pattern, c.Success, c.ZeroPrice, c.Errors)
+		total.Success += c.Success
+		total.ZeroPrice += c.ZeroPrice
+		total.Errors += c.Errors
+	}
+	fmt.Fprintf(tw, "Итого\t%d\t%d\t%d\n", total.Success, total.ZeroPrice, total.Errors)
+	tw.Flush()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// exportStockPlanXLSX сохраняет план остатков в формате шаблона загрузки
+// остатков в личном кабинете WB (колонки "Баркод" и "Количество"). Третья
+// колонка — страница поставщика, чтобы проверить подозрительный остаток.
+// Это запасной путь, когда API WB недоступен.
+func exportStockPlanXLSX(cfg Config, filePath string) error {
+	cfg.setDefaults()
+	db, err := sql.Open("sqlite", cfg.DBName)
+	if err != nil {
+		return fmt.Errorf("ошибка при открытии базы данных: %v", err)
+	}
+	defer db.Close()
+	if err := validateSchema(db); err != nil {
+		return fmt.Errorf("%s: %w", cfg.DBName, err)
+	}
+
+	lastStocks, err := loadLastStocks(cfg.StockStatePath)
+	if err != nil {
+		return err
+	}
+	plan, _, err := buildStockPlan(db, cfg, lastStocks)
+	if err != nil {
+		return err
+	}
+
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+
+	sheetName := "Sheet1"
+	if err := f.SetSheetRow(sheetName, "A1", &[]interface{}{"Баркод", "Количество", "Источник"}); err != nil {
+		return fmt.Errorf("ошибка записи заголовка: %v", err)
+	}
+	for i, item := range plan {
+		cell := fmt.Sprintf("A%d", i+2)
+		if err := f.SetSheetRow(sheetName, cell, &[]interface{}{item.SKU, item.Amount, item.SourceURL}); err != nil {
+			return fmt.Errorf("ошибка записи строки %d: %v", i+2, err)
+		}
+	}
+
+	if err := f.SaveAs(filePath); err != nil {
+		return fmt.Errorf("ошибка при сохранении Excel-файла: %v", err)
+	}
+	log.Printf("План остатков (%d SKU) сохранён в %s", len(plan), filePath)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// planAmounts — остатки плана по SKU.
+func planAmounts(t *testing.T, plan []stockItem) map[string]int {
+	t.Helper()
+	amounts := make(map[string]int, len(plan))
+	for _, item := range plan {
+		if _, dup := amounts[item.SKU]; dup {
+			t.Errorf("SKU %s в плане дважды", item.SKU)
+		}
+		amounts[item.SKU] = item.Amount
+	}
+	return amounts
+}
+
+func TestBuildStockPlanOutOfStockPolicy(t *testing.T) {
+	db, path := newTestDB(t)
+	insertProducts(t, db,
+		testProduct{VendorCode: "box_1_10", ProductID: "1", SKU: "in-stock", Pcs: 10, AvailableCount: 5},
+		testProduct{VendorCode: "box_2_10", ProductID: "2", SKU: "had-stock", Pcs: 10, AvailableCount: 0},
+		testProduct{VendorCode: "box_3_10", ProductID: "3", SKU: "had-zero", Pcs: 10, AvailableCount: 0},
+		testProduct{VendorCode: "box_4_10", ProductID: "4", SKU: "never-sent", Pcs: 10, AvailableCount: 0},
+	)
+	lastStocks := map[string]int{"had-stock": 7, "had-zero": 0}
+
+	tests := []struct {
+		policy      string
+		want        map[string]int
+		wantSkipped int
+	}{
+		{OutOfStockZero, map[string]int{"in-stock": 5, "had-stock": 0, "had-zero": 0, "never-sent": 0}, 0},
+		{OutOfStockSkip, map[string]int{"in-stock": 5}, 3},
+		{OutOfStockKeepLast, map[string]int{"in-stock": 5, "had-stock": 7}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cfg := testConfig(t, path)
+			cfg.OutOfStockPolicy = tt.policy
+
+			plan, skippedRows, err := buildStockPlan(db, cfg, lastStocks)
+			if err != nil {
+				t.Fatalf("buildStockPlan: %v", err)
+			}
+			if got := planAmounts(t, plan); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("план %v, want %v", got, tt.want)
+			}
+			if skippedRows != tt.wantSkipped {
+				t.Errorf("пропущено %d, want %d", skippedRows, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestBuildStockPlanPcsStockCaps(t *testing.T) {
+	db, path := newTestDB(t)
+	// По defaultAmountTable при наличии 5: pcs 10 -> 5, 30 -> 2, 1 -> 5, 100 -> 1
+	insertProducts(t, db,
+		testProduct{VendorCode: "box_1_10", ProductID: "1", SKU: "capped", Pcs: 10, AvailableCount: 5},
+		testProduct{VendorCode: "box_1_30", ProductID: "1", SKU: "under-cap", Pcs: 30, AvailableCount: 5},
+		testProduct{VendorCode: "box_1_1", ProductID: "1", SKU: "no-cap", Pcs: 1, AvailableCount: 5},
+		testProduct{VendorCode: "box_1_100", ProductID: "1", SKU: "zero-cap", Pcs: 100, AvailableCount: 5},
+	)
+	cfg := testConfig(t, path)
+	cfg.PcsStockCaps = map[int]int{10: 3, 30: 5, 100: 0}
+
+	plan, _, err := buildStockPlan(db, cfg, map[string]int{})
+	if err != nil {
+		t.Fatalf("buildStockPlan: %v", err)
+	}
+	want := map[string]int{"capped": 3, "under-cap": 2, "no-cap": 5, "zero-cap": 0}
+	if got := planAmounts(t, plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("план %v, want %v", got, want)
+	}
+}
+
+func TestBuildStockPlanMaxStockAmount(t *testing.T) {
+	prev := amountTable
+	amountTable = map[amountKey]int{
+		{AvailableCount: 5, Pcs: 10}: 5,
+		{AvailableCount: 5, Pcs: 30}: -3, // ошибка в своей таблице остатков
+		{AvailableCount: 5, Pcs: 1}:  3,
+	}
+	t.Cleanup(func() { amountTable = prev })
+
+	db, path := newTestDB(t)
+	insertProducts(t, db,
+		testProduct{VendorCode: "box_1_10", ProductID: "1", SKU: "above-max", Pcs: 10, AvailableCount: 5},
+		testProduct{VendorCode: "box_1_30", ProductID: "1", SKU: "negative", Pcs: 30, AvailableCount: 5},
+		testProduct{VendorCode: "box_1_1", ProductID: "1", SKU: "under-max", Pcs: 1, AvailableCount: 5},
+	)
+	cfg := testConfig(t, path)
+	cfg.MaxStockAmount = 4
+	// 5 × 10 = 50 — выше MaxStockAmount
+	cfg.AvailabilityMultiplierByPattern = map[string]float64{`^box_1_10$`: 10}
+
+	plan, _, err := buildStockPlan(db, cfg, map[string]int{})
+	if err != nil {
+		t.Fatalf("buildStockPlan: %v", err)
+	}
+	want := map[string]int{"above-max": 4, "negative": 0, "under-max": 3}
+	if got := planAmounts(t, plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("план %v, want %v", got, want)
+	}
+}
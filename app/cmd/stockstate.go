@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Политики для товаров, которых нет в наличии (calcAmount вернул 0).
+const (
+	OutOfStockZero     = "zero"      // отправить 0 — карточка на WB обнулится
+	OutOfStockSkip     = "skip"      // не отправлять SKU вовсе, остаток на WB не меняется
+	OutOfStockKeepLast = "keep_last" // отправить последний ненулевой остаток, который мы пушили
+)
+
+func validOutOfStockPolicy(p string) bool {
+	switch p {
+	case OutOfStockZero, OutOfStockSkip, OutOfStockKeepLast:
+		return true
+	}
+	return false
+}
+
+// loadLastStocks читает последние отправленные в WB остатки (sku -> amount).
+// Состояние хранится отдельно от БД, потому что Process удаляет её на каждом прогоне.
+// Отсутствующий файл — не ошибка, просто пустое состояние.
+func loadLastStocks(path string) (map[string]int, error) {
+	last := make(map[string]int)
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return last, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения %s: %v", path, err)
+	}
+	if err := json.Unmarshal(b, &last); err != nil {
+		return nil, fmt.Errorf("ошибка разбора %s: %v", path, err)
+	}
+	return last, nil
+}
+
+func saveLastStocks(path string, last map[string]int) error {
+	b, err := json.MarshalIndent(last, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга остатков: %v", err)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return fmt.Errorf("ошибка записи %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// WBSubjectsURL — справочник предметов WB (subjectID = objectID карточек).
+const WBSubjectsURL = "https://content-api.wildberries.ru/content/v2/object/all"
+
+type subjectsResponse struct {
+	Data []struct {
+		SubjectID   int    `json:"subjectID"`
+		SubjectName string `json:"subjectName"`
+	} `json:"data"`
+	Error     bool   `json:"error"`
+	ErrorText string `json:"errorText"`
+}
+
+// resolveSubjects переводит названия предметов WB в objectID. Найденные
+// соответствия хранятся в cachePath: ID предметов не меняются, поэтому кеш
+// бессрочный, и в WB уходят только названия, которых в нём ещё нет.
+func resolveSubjects(ctx context.Context, client *WBClient, names []string, cachePath string) ([]int, error) {
+	cache := loadSubjectsCache(cachePath)
+	changed := false
+
+	ids := make([]int, 0, len(names))
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		id, ok := cache[key]
+		if !ok {
+			var err error
+			id, err = client.findSubjectID(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			cache[key] = id
+			changed = true
+			log.Printf("Предмет %q -> objectID %d", name, id)
+		}
+		ids = append(ids, id)
+	}
+
+	if changed && cachePath != "" {
+		b, err := json.MarshalIndent(cache, "", "  ")
+		if err == nil {
+			err = os.WriteFile(cachePath, b, 0644)
+		}
+		if err != nil {
+			log.Printf("Не удалось сохранить кеш предметов %s: %v", cachePath, err)
+		}
+	}
+	return ids, nil
+}
+
+// loadSubjectsCache читает кеш "название в нижнем регистре -> objectID".
+// Отсутствующий или битый кеш — не ошибка, просто спросим WB заново.
+func loadSubjectsCache(path string) map[string]int {
+	cache := make(map[string]int)
+	if path == "" {
+		return cache
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(b, &cache); err != nil {
+		log.Printf("Ошибка разбора кеша предметов %s: %v", path, err)
+		return make(map[string]int)
+	}
+	return cache
+}
+
+// findSubjectID ищет предмет по названию. WB ищет по подстроке, поэтому
+// из ответа берётся только точное совпадение (без учёта регистра).
+func (c *WBClient) findSubjectID(ctx context.Context, name string) (int, error) {
+	q := url.Values{}
+	q.Set("name", name)
+	q.Set("limit", "1000")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.WBSubjectsURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", c.apiKey)
+
+	if err := c.wait(ctx, wbEndpointContent); err != nil {
+		return 0, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkAuthStatus(resp); err != nil {
+		return 0, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%w: статус %d, ответ: %s", ErrWBBadResponse, resp.StatusCode, bodySnippet(b))
+	}
+
+	var response subjectsResponse
+	if err := json.Unmarshal(b, &response); err != nil {
+		return 0, fmt.Errorf("%w: %v, ответ: %s", ErrWBBadResponse, err, bodySnippet(b))
+	}
+	if response.Error {
+		return 0, fmt.Errorf("ошибка поиска предмета %q: %s", name, response.ErrorText)
+	}
+	for _, s := range response.Data {
+		if strings.EqualFold(strings.TrimSpace(s.SubjectName), strings.TrimSpace(name)) {
+			return s.SubjectID, nil
+		}
+	}
+	return 0, fmt.Errorf("предмет %q не найден в справочнике WB", name)
+}
+
+// mergeObjectIDs объединяет ID из конфига и из названий предметов без повторов.
+func mergeObjectIDs(ids, extra []int) []int {
+	seen := make(map[int]bool, len(ids)+len(extra))
+	merged := make([]int, 0, len(ids)+len(extra))
+	for _, id := range append(append([]int(nil), ids...), extra...) {
+		if !seen[id] {
+			seen[id] = true
+			merged = append(merged, id)
+		}
+	}
+	return merged
+}
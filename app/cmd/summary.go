@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runSummary — машиночитаемый итог прогона для CI и мониторинга.
+type runSummary struct {
+	mu sync.Mutex
+
+	RunID           string    `json:"run_id,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	CardsFetched    int       `json:"cards_fetched"`
+	ProductsScraped int       `json:"products_scraped"`
+	ScrapeFailures  int       `json:"scrape_failures"`
+	ScrapeBlocked   int       `json:"scrape_blocked"`
+	BatchesSent     int       `json:"batches_sent"`
+	SKUsUpdated     int       `json:"skus_updated"`
+	SKUsFailed      int       `json:"skus_failed"`
+	SKUsSkipped     int       `json:"skus_skipped"`
+	SKUsDeleted     int       `json:"skus_deleted"`
+	SKUsDryRun      int       `json:"skus_dry_run,omitempty"` // в DryRun не отправлены, только записаны в лог
+	Errors          []string  `json:"errors"`
+
+	// Unmatched — артикулы карточек, не подошедшие ни под один шаблон, по objectID:
+	// по ним видно, каких VendorCodePatterns не хватает.
+	Unmatched map[int][]string `json:"unmatched_vendor_codes,omitempty"`
+}
+
+// summary заполняется по ходу прогона и пишется на диск в конце main.
+var summary = &runSummary{StartedAt: time.Now()}
+
+// update применяет fn к сводке под мьютексом.
+func (s *runSummary) update(fn func(s *runSummary)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s)
+}
+
+// scrapeFailureRate — доля страниц, которые так и не удалось спарсить.
+func (s *runSummary) scrapeFailureRate() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := s.ProductsScraped + s.ScrapeFailures
+	if total == 0 {
+		return 0
+	}
+	return float64(s.ScrapeFailures) / float64(total)
+}
+
+func (s *runSummary) addUnmatched(objectID int, vendorCode string) {
+	s.update(func(s *runSummary) {
+		if s.Unmatched == nil {
+			s.Unmatched = make(map[int][]string)
+		}
+		s.Unmatched[objectID] = append(s.Unmatched[objectID], vendorCode)
+	})
+}
+
+// logUnmatched печатает артикулы без шаблона, сгруппированные по objectID.
+func (s *runSummary) logUnmatched() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objectIDs := make([]int, 0, len(s.Unmatched))
+	for id := range s.Unmatched {
+		objectIDs = append(objectIDs, id)
+	}
+	sort.Ints(objectIDs)
+	for _, id := range objectIDs {
+		codes := s.Unmatched[id]
+		sort.Strings(codes)
+		log.Printf("Не подошли ни под один шаблон, objectID=%d (%d): %s", id, len(codes), strings.Join(codes, ", "))
+	}
+}
+
+func (s *runSummary) addError(err error) {
+	s.update(func(s *runSummary) { s.Errors = append(s.Errors, err.Error()) })
+}
+
+// reset начинает новую сводку — для повторных прогонов в режиме -serve.
+func (s *runSummary) reset() {
+	s.update(func(s *runSummary) {
+		s.RunID = ""
+		s.StartedAt, s.FinishedAt = time.Now(), time.Time{}
+		s.CardsFetched, s.ProductsScraped, s.ScrapeFailures, s.ScrapeBlocked = 0, 0, 0, 0
+		s.BatchesSent, s.SKUsUpdated, s.SKUsFailed, s.SKUsSkipped, s.SKUsDeleted, s.SKUsDryRun = 0, 0, 0, 0, 0, 0
+		s.Errors = nil
+		s.Unmatched = nil
+	})
+}
+
+// finish фиксирует время окончания и возвращает сводку в JSON.
+func (s *runSummary) finish() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.FinishedAt = time.Now()
+	if s.Errors == nil {
+		s.Errors = []string{}
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка маршалинга сводки: %v", err)
+	}
+	return b, nil
+}
+
+// write сохраняет сводку в JSON-файл по указанному пути.
+func (s *runSummary) write(path string) error {
+	b, err := s.finish()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return fmt.Errorf("ошибка записи сводки %s: %v", path, err)
+	}
+	return nil
+}
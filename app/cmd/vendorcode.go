@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// DefaultVendorCodeRegexp повторяет прежний разбор через strings.Split:
+// второй сегмент — productID, третий (если есть) — pcs.
+const DefaultVendorCodeRegexp = `^[^_]+_(?P<productID>[^_]+)(?:_(?P<pcs>[^_]*))?`
+
+// vendorCode — разобранный артикул продавца вида "box_500_10".
+type vendorCode struct {
+	Raw       string
+	ProductID string
+	Pcs       int  // 1, если pcs в артикуле нет или он не число
+	HasPcs    bool // pcs явно указан в артикуле
+}
+
+// vendorCodeParser разбирает артикулы по регулярке с именованными группами
+// productID (обязательна) и pcs (необязательна).
+type vendorCodeParser struct {
+	re     *regexp.Regexp
+	idIdx  int
+	pcsIdx int
+}
+
+func newVendorCodeParser(expr string) (*vendorCodeParser, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный VendorCodeRegexp %q: %v", expr, err)
+	}
+	p := &vendorCodeParser{re: re, idIdx: re.SubexpIndex("productID"), pcsIdx: re.SubexpIndex("pcs")}
+	if p.idIdx < 0 {
+		return nil, fmt.Errorf("в VendorCodeRegexp %q нет группы (?P<productID>...)", expr)
+	}
+	return p, nil
+}
+
+func (p *vendorCodeParser) parse(raw string) (vendorCode, error) {
+	m := p.re.FindStringSubmatch(raw)
+	if m == nil || m[p.idIdx] == "" {
+		return vendorCode{}, fmt.Errorf("vendorCode=%s: не соответствует VendorCodeRegexp", raw)
+	}
+	vc := vendorCode{Raw: raw, ProductID: m[p.idIdx], Pcs: 1}
+	if p.pcsIdx >= 0 && m[p.pcsIdx] != "" {
+		if val, err := strconv.Atoi(m[p.pcsIdx]); err == nil {
+			vc.Pcs = val
+			vc.HasPcs = true
+		}
+	}
+	return vc, nil
+}
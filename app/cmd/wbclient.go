@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Эндпоинты WB с собственными лимитами запросов.
+const (
+	wbEndpointStocks  = "stocks"
+	wbEndpointPrices  = "prices"
+	wbEndpointContent = "content"
+)
+
+// defaultRateLimits — лимиты WB в запросах в минуту по эндпоинтам.
+var defaultRateLimits = map[string]int{
+	wbEndpointStocks:  RequestLimit,
+	wbEndpointPrices:  100, // 10 запросов за 6 секунд
+	wbEndpointContent: 100,
+}
+
+// ErrWBAuth — WB отверг токен (401/403). Продолжать прогон с ним бессмысленно.
+var ErrWBAuth = errors.New("ошибка авторизации WB — проверьте WB_API_KEY")
+
+// pushAttempts — по умолчанию для Retry.Push: сколько раз отправлять пачку остатков, если WB не ответил вовремя.
+const pushAttempts = 3
+
+// isTimeoutError — запрос не уложился в таймаут; такой запрос можно повторить.
+func isTimeoutError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// ErrWBBadResponse — WB ответил не тем, что ожидалось (не JSON, 5xx и т. п.).
+// Обычно это временно, запрос можно повторить.
+var ErrWBBadResponse = errors.New("некорректный ответ WB")
+
+// Размер страницы списка карточек (Config.CardsPageSize).
+const (
+	defaultCardsPageSize = 100
+	maxCardsPageSize     = 1000
+)
+
+// cardsListAttempts — по умолчанию для Retry.Cards: сколько раз запрашивать страницу карточек при кривом ответе.
+const cardsListAttempts = 3
+
+// bodySnippet возвращает начало тела ответа для сообщений об ошибках.
+func bodySnippet(b []byte) string {
+	const max = 200
+	s := strings.TrimSpace(string(b))
+	if r := []rune(s); len(r) > max {
+		return string(r[:max]) + "…"
+	}
+	return s
+}
+
+// checkAuthStatus превращает 401/403 в ErrWBAuth.
+func checkAuthStatus(resp *http.Response) error {
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: статус %d, ответ: %s", ErrWBAuth, resp.StatusCode, string(b))
+	}
+	return nil
+}
+
+// Таймауты HTTP для всех запросов в WB.
+const (
+	wbHTTPTimeout     = 30 * time.Second // на весь запрос, включая чтение тела
+	wbDialTimeout     = 10 * time.Second
+	wbTLSTimeout      = 10 * time.Second
+	wbIdleConnTimeout = 90 * time.Second
+)
+
+// wbHTTPClient — общий клиент для всех вызовов WB. Один Transport держит
+// keep-alive соединения, поэтому пачки остатков и страницы карточек
+// не открывают каждый раз новое TCP/TLS-соединение.
+var wbHTTPClient = &http.Client{
+	Timeout: wbHTTPTimeout,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   wbDialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       wbIdleConnTimeout,
+		TLSHandshakeTimeout:   wbTLSTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
+// WBClient ходит в API WB, соблюдая лимит каждого эндпоинта отдельно.
+type WBClient struct {
+	apiKey   string
+	cfg      Config
+	http     *http.Client
+	pushHTTP *http.Client // для остатков: тот же Transport, но таймаут PushTimeout
+	limiters map[string]*rateLimiter
+}
+
+func newWBClient(apiKey string, cfg Config) *WBClient {
+	c := &WBClient{
+		apiKey:   apiKey,
+		cfg:      cfg,
+		http:     wbHTTPClient,
+		pushHTTP: &http.Client{Transport: wbHTTPClient.Transport, Timeout: cfg.PushTimeout},
+		limiters: make(map[string]*rateLimiter),
+	}
+	for endpoint, perMinute := range cfg.RateLimits {
+		c.limiters[endpoint] = newRateLimiter(perMinute)
+	}
+	return c
+}
+
+// wait ждёт свободный слот лимитера эндпоинта. Эндпоинты без лимита не ждут.
+func (c *WBClient) wait(ctx context.Context, endpoint string) error {
+	if l, ok := c.limiters[endpoint]; ok {
+		return l.Wait(ctx)
+	}
+	return ctx.Err()
+}
+
+func (c *WBClient) Close() {
+	for _, l := range c.limiters {
+		l.Stop()
+	}
+}
+
+// newJSONRequest собирает запрос к WB с JSON-телом и токеном. С GzipRequests
+// тело сжимается: пачка из 1000 остатков — около 58 КБ JSON и 12 КБ в gzip.
+func (c *WBClient) newJSONRequest(ctx context.Context, method, url string, body []byte) (*http.Request, error) {
+	if c.cfg.GzipRequests {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, fmt.Errorf("ошибка сжатия запроса: %v", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("ошибка сжатия запроса: %v", err)
+		}
+		debugf("Тело запроса %s %s: %d байт, в gzip %d", method, url, len(body), buf.Len())
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if c.cfg.GzipRequests {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return req, nil
+}
+
+// sendStockBatch отправляет одну пачку остатков в WB.
+func (c *WBClient) sendStockBatch(ctx context.Context, batch []stockItem) error {
+	// Формируем JSON
+	payload := stockRequest{Stocks: batch}
+	jsonBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга JSON: %v", err)
+	}
+
+	if c.cfg.DryRun {
+		log.Printf("[dry-run] PUT остатков: %d SKU, %d байт", len(batch), len(jsonBytes))
+		return nil
+	}
+
+	// Создаём PUT-запрос
+	url := fmt.Sprintf(c.cfg.WBStocksURL, WarehouseID)
+	req, err := c.newJSONRequest(ctx, http.MethodPut, url, jsonBytes)
+	if err != nil {
+		return err
+	}
+
+	if err := c.wait(ctx, wbEndpointStocks); err != nil {
+		return err
+	}
+	resp, err := c.pushHTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка при отправке запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkAuthStatus(resp); err != nil {
+		return err
+	}
+
+	// Считываем статус
+	if resp.StatusCode != http.StatusNoContent {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return &stockBatchError{
+			Status:   resp.StatusCode,
+			Body:     string(b),
+			Rejected: parseRejectedSKUs(b),
+		}
+	}
+	return nil
+}
+
+// deleteStocks удаляет остатки SKU со склада (DELETE /api/v3/stocks/{warehouseId}),
+// теми же пачками по BatchSize и с тем же лимитом, что и отправка остатков.
+// Возвращает SKU, которые удалось удалить, и первую ошибку.
+func (c *WBClient) deleteStocks(ctx context.Context, skus []string) ([]string, error) {
+	var deleted []string
+	for _, batch := range splitBatches(skus, BatchSize) {
+		jsonBytes, err := json.Marshal(struct {
+			SKUs []string `json:"skus"`
+		}{batch})
+		if err != nil {
+			return deleted, fmt.Errorf("ошибка маршалинга JSON: %v", err)
+		}
+		if c.cfg.DryRun {
+			// Ничего не удалено — в итогах и last_stocks.json эти SKU не учитываются
+			log.Printf("[dry-run] DELETE остатков: %d SKU", len(batch))
+			continue
+		}
+		url := fmt.Sprintf(c.cfg.WBStocksURL, WarehouseID)
+		req, err := c.newJSONRequest(ctx, http.MethodDelete, url, jsonBytes)
+		if err != nil {
+			return deleted, err
+		}
+
+		if err := c.wait(ctx, wbEndpointStocks); err != nil {
+			return deleted, err
+		}
+		resp, err := c.pushHTTP.Do(req)
+		if err != nil {
+			return deleted, fmt.Errorf("ошибка при удалении остатков: %w", err)
+		}
+		if err := checkAuthStatus(resp); err != nil {
+			resp.Body.Close()
+			return deleted, err
+		}
+		if resp.StatusCode != http.StatusNoContent {
+			b, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			return deleted, fmt.Errorf("ошибка при удалении остатков: статус %d  тело ответа: %s", resp.StatusCode, string(b))
+		}
+		resp.Body.Close()
+		deleted = append(deleted, batch...)
+	}
+	return deleted, nil
+}
+
+// stockBatchError — WB не принял пачку остатков. Rejected заполнен, если
+// в ответе перечислены конкретные SKU, из-за которых пачка отклонена.
+type stockBatchError struct {
+	Status   int
+	Body     string
+	Rejected map[string]string // sku -> причина
+}
+
+func (e *stockBatchError) Error() string {
+	return fmt.Sprintf("ошибка при обновлении: статус %d  тело ответа: %s", e.Status, e.Body)
+}
+
+// wbStockError — элемент ответа WB с ошибкой по остаткам:
+// {"code": "...", "message": "...", "data": [{"sku": "...", "amount": 0}]}.
+type wbStockError struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// parseRejectedSKUs достаёт из тела ответа SKU с причинами отказа.
+// WB присылает либо массив ошибок, либо одну ошибку; data бывает не только списком SKU.
+func parseRejectedSKUs(body []byte) map[string]string {
+	var errs []wbStockError
+	if err := json.Unmarshal(body, &errs); err != nil {
+		var single wbStockError
+		if err := json.Unmarshal(body, &single); err != nil {
+			return nil
+		}
+		errs = []wbStockError{single}
+	}
+
+	rejected := make(map[string]string)
+	for _, e := range errs {
+		var items []struct {
+			SKU string `json:"sku"`
+		}
+		if err := json.Unmarshal(e.Data, &items); err != nil {
+			continue
+		}
+		reason := strings.TrimSpace(e.Code + ": " + e.Message)
+		for _, item := range items {
+			if item.SKU != "" {
+				rejected[item.SKU] = reason
+			}
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	return rejected
+}